@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/metrics"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var backfillLookback int
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill [namespace...]",
+	Short: "Backfill the metrics store from the history kept by the metrics source",
+	Long: `Read container CPU and memory usage, CPU throttling and restarts from the configured
+metrics source over the lookback window and store them, so that resources can be
+recommended without a live observation period. Only the prometheus source keeps history.
+Namespaces default to all non-ignored namespaces; periods already backfilled into the session
+given by --session are skipped.`,
+	Run: backfill,
+}
+
+func backfill(cmd *cobra.Command, args []string) {
+	source, err := metrics.NewSource(conf.Metrics)
+	if err != nil {
+		fmt.Printf("Error creating metrics source: %v\n", err)
+		os.Exit(1)
+	}
+	history, ok := source.(metrics.HistorySource)
+	if !ok {
+		fmt.Printf("Error: metrics source '%s' does not keep history, set metrics.source to prometheus\n", conf.Metrics.Source)
+		os.Exit(1)
+	}
+
+	namespaces := args
+	if len(namespaces) == 0 {
+		namespaces, err = client.Namespaces()
+		if err != nil {
+			fmt.Printf("Error listing namespaces: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	lookback := time.Duration(backfillLookback) * time.Hour
+	startSession(cmd)
+	if err := metrics.Backfill(context.Background(), history, namespaces, lookback); err != nil {
+		fmt.Printf("Error backfilling metrics: %v\n", err)
+		os.Exit(1)
+	}
+	endSession()
+	fmt.Println("Backfill completed")
+}
+
+func init() {
+	backfillCmd.Flags().IntVar(&backfillLookback, "lookback", conf.Metrics.Prometheus.Lookback, "hours of history to backfill")
+	addWriteSessionFlags(backfillCmd)
+	rootCmd.AddCommand(backfillCmd)
+}
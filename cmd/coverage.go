@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/coverage"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var coverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Show how well each workload has been observed and whether its observations are stable",
+	Long: `List every workload in the observed namespaces with when it was first and last seen, how many
+behaviour observations were received and how long ago a new capability, file or syscall was recorded.
+A workload is stable once it has coverage.minSamples observations and nothing new was recorded for
+coverage.stableAfter minutes.`,
+	Run: showCoverage,
+}
+
+func showCoverage(cmd *cobra.Command, args []string) {
+	selectSessions()
+	reports, err := coverage.Cluster(context.Background())
+	if err != nil {
+		fmt.Printf("Error checking observation coverage: %v\n", err)
+		os.Exit(1)
+	}
+	now := time.Now()
+	stable := 0
+	fmt.Printf("%-48s %-20s %-20s %8s %12s %s\n", "WORKLOAD", "FIRST SEEN", "LAST SEEN", "SAMPLES", "SINCE NEW", "STATUS")
+	for _, r := range reports {
+		workload := fmt.Sprintf("%s/%s/%s", r.Workload.Namespace, r.Workload.Kind, r.Workload.Name)
+		status := "stable"
+		if r.Stable {
+			stable++
+		} else {
+			status = "unstable: " + r.Reason
+		}
+		if !r.Observed {
+			fmt.Printf("%-48s %-20s %-20s %8d %12s %s\n", workload, "-", "-", 0, "-", status)
+			continue
+		}
+		fmt.Printf("%-48s %-20s %-20s %8d %12s %s\n", workload, r.FirstSeen.Format(time.DateTime), r.LastSeen.Format(time.DateTime),
+			r.Samples, r.SinceLastNew(now).Round(time.Minute), status)
+	}
+	fmt.Printf("\n%d of %d workloads have stable observations.\n", stable, len(reports))
+}
+
+func init() {
+	addReadSessionsFlag(coverageCmd)
+	rootCmd.AddCommand(coverageCmd)
+}
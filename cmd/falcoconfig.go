@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/falco"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	falcoConfigURL      string
+	falcoConfigSyscalls bool
+)
+
+var falcoConfigCmd = &cobra.Command{
+	Use:   "falco-config",
+	Short: "Generate Falco rules and Helm values that send exactly the events kubefix observes",
+	Long: `Generate a Falco rules file whose rules emit exactly the events kubefix consumes — file writes,
+capability use, program execution and connections — for every namespace not listed in ignoreNamespaces,
+and Helm values for the falcosecurity/falco chart that load those rules and enable http_output
+towards the observe listener.
+
+Files are written to <falcoConfigDir>/kubefix_rules.yaml and <falcoConfigDir>/falco-values.yaml.
+Use --syscalls to also emit every syscall for seccomp profile generation; this greatly increases the event rate.`,
+	Run: generateFalcoConfig,
+}
+
+func generateFalcoConfig(cmd *cobra.Command, args []string) {
+	url := falcoConfigURL
+	if url == "" {
+		var err error
+		url, err = defaultAlertURL()
+		if err != nil {
+			fmt.Printf("Error deriving alert URL: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	rules, err := falco.RulesFile(conf.IgnoreNamespaces, falcoConfigSyscalls)
+	if err != nil {
+		fmt.Printf("Error generating Falco rules: %v\n", err)
+		os.Exit(1)
+	}
+	values, err := falco.HelmValues(url, rules, conf.Falco)
+	if err != nil {
+		fmt.Printf("Error generating Helm values: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(conf.FalcoConfigDir, 0755); err != nil {
+		fmt.Printf("Error creating Falco config directory '%s': %v\n", conf.FalcoConfigDir, err)
+		os.Exit(1)
+	}
+	for name, content := range map[string][]byte{"kubefix_rules.yaml": rules, "falco-values.yaml": values} {
+		path := filepath.Join(conf.FalcoConfigDir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			fmt.Printf("Error writing '%s': %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	fmt.Printf("Falco will send alerts to %s\n", url)
+}
+
+// defaultAlertURL 根据 falco.listen 和本机主机名推导 Falco 发送告警的地址
+func defaultAlertURL() (string, error) {
+	if conf.Falco.Listen == "off" {
+		return "", fmt.Errorf("the HTTP listener is disabled (falco.listen is off), pass --url")
+	}
+	host, port, err := net.SplitHostPort(conf.Falco.Listen)
+	if err != nil {
+		return "", fmt.Errorf("parse falco.listen '%s': %w", conf.Falco.Listen, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		if host, err = os.Hostname(); err != nil {
+			return "", err
+		}
+	}
+	scheme := "http"
+	if conf.Falco.TLSCert != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/alert", scheme, net.JoinHostPort(host, port)), nil
+}
+
+func init() {
+	falcoConfigCmd.Flags().StringVar(&falcoConfigURL, "url", "", "URL Falco sends alerts to (default derived from falco.listen and the hostname)")
+	falcoConfigCmd.Flags().BoolVar(&falcoConfigSyscalls, "syscalls", false, "Also emit every syscall for seccomp profile generation")
+	rootCmd.AddCommand(falcoConfigCmd)
+}
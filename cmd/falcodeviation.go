@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/falco"
+	"kubefix-cli/pkg/fixer"
+	"kubefix-cli/pkg/netpol"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var falcoDeviationPriority string
+
+var falcoDeviationCmd = &cobra.Command{
+	Use:   "falco-deviation",
+	Short: "Generate Falco rules that alert when a workload deviates from its observed baseline",
+	Long: `Turn the behaviour observe learned for every workload in resourceDir into workload-specific Falco rules.
+Each container gets rules that alert when it executes a program, writes a file outside the observed
+directories or makes a syscall needing a capability that was not seen during observation.
+
+Rules are written to <falcoConfigDir>/kubefix_deviation_rules.yaml; load them with the Helm chart's
+customRules. Workloads without observation data are skipped.`,
+	Run: generateFalcoDeviation,
+}
+
+func generateFalcoDeviation(cmd *cobra.Command, args []string) {
+	selectSessions()
+	if _, err := os.Stat(conf.ResourceDir); os.IsNotExist(err) {
+		fmt.Printf("Error: Input directory '%s' does not exist\n", conf.ResourceDir)
+		os.Exit(1)
+	}
+	files, err := filepath.Glob(filepath.Join(conf.ResourceDir, "*.yaml"))
+	if err != nil {
+		fmt.Printf("Error scanning input directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	var baselines []falco.Baseline
+	for _, resourceFile := range files {
+		prefix := strings.TrimSuffix(filepath.Base(resourceFile), ".yaml")
+		content, err := os.ReadFile(resourceFile)
+		if err != nil {
+			fmt.Printf("error reading resource file %s: %v\n", resourceFile, err)
+			continue
+		}
+		workload, err := fixer.ParseManifest(content)
+		// Pods created by a controller are covered by the controller's rules
+		if err != nil || workload.PodSpec() == nil || workload.Kind() == "Pod" && netpol.ControllerManaged(workload.PodLabels()) {
+			continue
+		}
+		baseline, err := fixer.ObservedBaseline(workload)
+		if err != nil {
+			fmt.Printf("%s: error reading observed baseline: %v\n", prefix, err)
+			continue
+		}
+		if baseline == nil {
+			fmt.Printf("%s: no observation data, skipped\n", prefix)
+			continue
+		}
+		for _, c := range baseline.Containers {
+			if len(c.Processes) == 0 {
+				fmt.Printf("%s: no programs observed for container %s, exec rule skipped\n", prefix, c.Name)
+			}
+		}
+		baselines = append(baselines, *baseline)
+		fmt.Printf("  - %s: %d containers\n", prefix, len(baseline.Containers))
+	}
+
+	rules, err := falco.DeviationRules(baselines, falcoDeviationPriority)
+	if err != nil {
+		fmt.Printf("Error generating deviation rules: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(conf.FalcoConfigDir, 0755); err != nil {
+		fmt.Printf("Error creating Falco config directory '%s': %v\n", conf.FalcoConfigDir, err)
+		os.Exit(1)
+	}
+	path := filepath.Join(conf.FalcoConfigDir, "kubefix_deviation_rules.yaml")
+	if err := os.WriteFile(path, rules, 0644); err != nil {
+		fmt.Printf("Error writing '%s': %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nDeviation rules for %d workloads saved to: %s\n", len(baselines), path)
+}
+
+func init() {
+	falcoDeviationCmd.Flags().StringVar(&falcoDeviationPriority, "priority", "WARNING", "Priority of the generated rules")
+	addReadSessionsFlag(falcoDeviationCmd)
+	rootCmd.AddCommand(falcoDeviationCmd)
+}
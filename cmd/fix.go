@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"kubefix-cli/conf"
+	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/fixer"
 	"kubefix-cli/pkg/llm"
 	"kubefix-cli/pkg/utils"
 	"os"
@@ -19,6 +22,7 @@ var fixCmd = &cobra.Command{
 }
 
 func fix(cmd *cobra.Command, args []string) {
+	selectSessions()
 	if _, err := os.Stat(conf.ResourceDir); os.IsNotExist(err) {
 		fmt.Printf("Error: Input directory '%s' does not exist\n", conf.ResourceDir)
 		os.Exit(1)
@@ -34,12 +38,24 @@ func fix(cmd *cobra.Command, args []string) {
 	}
 	utils.CleanDirectory(conf.FixDir)
 
+	provider, err := llm.NewProvider(conf.LLM)
+	if err != nil {
+		fmt.Printf("Error creating LLM provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	if prober, err := client.NewPodProber(); err != nil {
+		fmt.Printf("Warning: cannot reach the cluster, probes will not be checked against Services or HTTP endpoints: %v\n", err)
+	} else {
+		fixer.Cluster = prober
+	}
+
 	lintFiles, err := filepath.Glob(filepath.Join(conf.LintDir, "*.txt"))
 	if err != nil {
 		fmt.Printf("Error scanning lint directory: %v\n", err)
 		os.Exit(1)
 	}
-	
+
 	for _, lintFile := range lintFiles {
 		// get the prefix of lintFile
 		baseFileName := filepath.Base(lintFile)
@@ -59,30 +75,41 @@ func fix(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 
-		fixed, err := llm.GenFix(resourceContent, lintContent)
-		if err != nil {
-			fmt.Printf("error generating fixed: %v", err)
-			continue
+		job := fixer.Job{Object: prefix, Resource: resourceContent, Lint: lintContent}
+		if err := fixer.Prepare(&job); err != nil {
+			fmt.Printf("%s: error applying observation-based fixes: %v\n", prefix, err)
+		}
+		for _, warning := range job.Warnings {
+			fmt.Printf("%s: warning: %s\n", prefix, warning)
 		}
 
-		// Create a new file to save the fixed resource
-		fixedFileName := strings.TrimSuffix(filepath.Base(lintFile), ".txt") + ".yaml"
-		fixedFilePath := filepath.Join(conf.FixDir, fixedFileName)
-		fixedFile, err := os.Create(fixedFilePath)
+		result := fixer.Run(provider, job, conf.FixRounds)
+		fmt.Printf("%s: %s after %d round(s)\n", prefix, result.History.Status, len(result.History.Rounds))
+
+		// Save the round history of this object
+		historyFilePath := filepath.Join(conf.FixDir, prefix+".history.json")
+		history, err := json.MarshalIndent(result.History, "", "  ")
 		if err != nil {
-			fmt.Printf("error creating fixed file %s: %v", fixedFilePath, err)
+			fmt.Printf("error marshaling history of %s: %v\n", prefix, err)
+		} else if err := os.WriteFile(historyFilePath, history, 0644); err != nil {
+			fmt.Printf("error writing history file %s: %v\n", historyFilePath, err)
+		}
+
+		if result.Fixed == nil {
 			continue
 		}
-		defer fixedFile.Close()
-		if _, err := fixedFile.Write(fixed); err != nil {
-			fmt.Printf("error writing to fixed file %s: %v", fixedFilePath, err)
+
+		// Create a new file to save the fixed resource
+		fixedFilePath := filepath.Join(conf.FixDir, prefix+".yaml")
+		if err := os.WriteFile(fixedFilePath, result.Fixed, 0644); err != nil {
+			fmt.Printf("error writing to fixed file %s: %v\n", fixedFilePath, err)
 		}
-		break
 	}
 
-	fmt.Printf("\nLint completed. Results saved to: %s\n", conf.LintDir)
+	fmt.Printf("\nFix completed. Results saved to: %s\n", conf.FixDir)
 }
 
 func init() {
+	addReadSessionsFlag(fixCmd)
 	rootCmd.AddCommand(fixCmd)
 }
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/fixer"
+	"kubefix-cli/pkg/netpol"
+	"kubefix-cli/pkg/utils"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var netpolCmd = &cobra.Command{
+	Use:   "netpol",
+	Short: "Generate least-privilege NetworkPolicies from observed traffic",
+	Long: `Generate a NetworkPolicy for every workload in resourceDir that allows exactly the connections
+observed for it, plus DNS egress. Workloads without observed connections get no policy and are listed
+as not observed. A namespace's kubefix-default-deny policy is only written once every workload of the
+namespace in resourceDir has a policy, so that it cannot cut off traffic that was never observed.
+
+Egress is learned from the "kubefix outbound connection" Falco rule, which only sees connect calls:
+UDP traffic sent with sendto on an unconnected socket is never observed and therefore never allowed.
+Ingress is learned from accepted TCP connections only, so inbound UDP is never allowed either.
+DNS egress to kube-dns is always allowed.`,
+	Run: generateNetpol,
+}
+
+func generateNetpol(cmd *cobra.Command, args []string) {
+	selectSessions()
+	if _, err := os.Stat(conf.ResourceDir); os.IsNotExist(err) {
+		fmt.Printf("Error: Input directory '%s' does not exist\n", conf.ResourceDir)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(conf.NetpolDir, 0755); err != nil {
+		fmt.Printf("Error creating output directory '%s': %v\n", conf.NetpolDir, err)
+		os.Exit(1)
+	}
+	utils.CleanDirectory(conf.NetpolDir)
+
+	namespaces, err := client.Namespaces()
+	if err != nil {
+		fmt.Printf("Error listing namespaces: %v\n", err)
+		os.Exit(1)
+	}
+	files, err := filepath.Glob(filepath.Join(conf.ResourceDir, "*.yaml"))
+	if err != nil {
+		fmt.Printf("Error scanning input directory: %v\n", err)
+		os.Exit(1)
+	}
+	// 命名空间中没有策略的工作负载，default-deny 会切断它们的流量
+	uncovered := map[string][]string{}
+	workloads := map[string]bool{}
+	for _, resourceFile := range files {
+		prefix := strings.TrimSuffix(filepath.Base(resourceFile), ".yaml")
+		content, err := os.ReadFile(resourceFile)
+		if err != nil {
+			fmt.Printf("error reading resource file %s: %v\n", resourceFile, err)
+			continue
+		}
+		workload, err := fixer.ParseManifest(content)
+		// Pods created by a controller are covered by the controller's policy
+		if err != nil || workload.PodSpec() == nil || workload.Kind() == "Pod" && netpol.ControllerManaged(workload.PodLabels()) {
+			continue
+		}
+
+		ns := workload.Namespace()
+		workloads[ns] = true
+		conns, err := fixer.ObservedConnections(workload)
+		if err != nil {
+			fmt.Printf("%s: error reading observed connections: %v\n", prefix, err)
+			uncovered[ns] = append(uncovered[ns], prefix)
+			continue
+		}
+		if len(conns) == 0 {
+			fmt.Printf("%s: not observed, no NetworkPolicy generated\n", prefix)
+			uncovered[ns] = append(uncovered[ns], prefix)
+			continue
+		}
+		policy, err := netpol.Generate(workload, conns)
+		if err != nil {
+			fmt.Printf("%s: %v\n", prefix, err)
+			uncovered[ns] = append(uncovered[ns], prefix)
+			continue
+		}
+		writePolicy(policy, fmt.Sprintf("networkpolicy-%s.yaml", netpol.PolicyName(workload)))
+	}
+
+	for _, ns := range namespaces {
+		switch {
+		case !workloads[ns]:
+			fmt.Printf("%s: no workloads in %s, default-deny skipped\n", ns, conf.ResourceDir)
+		case len(uncovered[ns]) > 0:
+			fmt.Printf("%s: default-deny skipped, workloads without a policy: %s\n", ns, strings.Join(uncovered[ns], ", "))
+		default:
+			writePolicy(netpol.DefaultDeny(ns), fmt.Sprintf("networkpolicy-kubefix-default-deny-%s.yaml", ns))
+		}
+	}
+
+	fmt.Printf("\nNetworkPolicies saved to: %s\n", conf.NetpolDir)
+}
+
+func writePolicy(policy map[string]any, fileName string) {
+	out, err := yaml.Marshal(policy)
+	if err != nil {
+		fmt.Printf("error marshaling %s: %v\n", fileName, err)
+		return
+	}
+	filePath := filepath.Join(conf.NetpolDir, fileName)
+	if err := os.WriteFile(filePath, out, 0644); err != nil {
+		fmt.Printf("error writing %s: %v\n", filePath, err)
+		return
+	}
+	fmt.Printf("  - Generated: %s\n", fileName)
+}
+
+func init() {
+	addReadSessionsFlag(netpolCmd)
+	rootCmd.AddCommand(netpolCmd)
+}
@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"kubefix-cli/conf"
 	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/coverage"
+	"kubefix-cli/pkg/db"
 	"kubefix-cli/pkg/falco"
 	"kubefix-cli/pkg/metrics"
+	"kubefix-cli/pkg/utils"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -14,18 +23,118 @@ import (
 var observeCmd = &cobra.Command{
 	Use:   "observe",
 	Short: "Observe the namespaces, metrics, and behaviors of all pods in namespaces.",
-	Run:   observe,
+	Long: `Observe the namespaces, metrics, and behaviors of all pods in namespaces for observeTime minutes.
+OOM kills, crash loops, probe failures, CPU throttling warnings and scheduling failures reported
+through pod statuses and Events are recorded per workload.
+
+When coverage.maxObserveTime is larger than observeTime, observing continues after observeTime
+until every workload has stable observations or the maximum is reached.
+
+Collectors that fail are restarted with backoff. On SIGINT or SIGTERM the Falco alert server
+and the metrics collector are shut down after their pending writes complete; a second signal
+exits immediately.
+
+Observations are stored in the session given by --session, tagged with the cluster and the time
+range of the run. Coverage and the summary printed at the end refer to this session only.`,
+	Run: observe,
 }
 
 func observe(cmd *cobra.Command, args []string) {
-	go client.CollectNamespace()
-	go falco.StartFalcoAlertServer()
-	go metrics.ObservePodMetrics()
-	duration := time.Duration(conf.ObserveTime) * time.Minute
-	time.Sleep(duration)
-	fmt.Println("Observing finished, killing all goroutines.")
+	started := time.Now()
+	startSession(cmd)
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	minimum := time.Duration(conf.ObserveTime) * time.Minute
+	adaptive := conf.Coverage.MaxObserveTime > conf.ObserveTime
+	ctx, cancel := context.WithTimeout(signalCtx, max(minimum, time.Duration(conf.Coverage.MaxObserveTime)*time.Minute))
+	defer cancel()
+
+	collectors := map[string]func(context.Context) error{
+		"Namespace collector": client.CollectNamespace,
+		"Falco ingestion":     falco.StartFalcoIngestion,
+		"Metrics collector":   metrics.ObservePodMetrics,
+		"Incident collector":  client.ObserveIncidents,
+	}
+	var wg sync.WaitGroup
+	for name, collector := range collectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			utils.Supervise(ctx, name, collector)
+		}()
+	}
+
+	if adaptive {
+		// 运行 observeTime 后，所有工作负载的观测稳定时提前结束
+		go func() {
+			if coverage.WaitForStability(ctx, minimum) {
+				fmt.Println("All workloads reached stable coverage.")
+				cancel()
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	// 恢复默认的信号处理，再次中断时立即退出
+	stop()
+	switch {
+	case signalCtx.Err() != nil:
+		fmt.Println("Interrupted, waiting for pending writes...")
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && adaptive:
+		fmt.Println("Maximum observe time reached, waiting for pending writes...")
+	default:
+		fmt.Println("Observing finished, waiting for pending writes...")
+	}
+	wg.Wait()
+	endSession()
+	printObservationSummary(started)
+	printUnstableWorkloads()
+}
+
+// printUnstableWorkloads 列出观测尚未稳定的工作负载
+func printUnstableWorkloads() {
+	reports, err := coverage.Cluster(context.Background())
+	if err != nil {
+		fmt.Printf("Error checking observation coverage: %v\n", err)
+		return
+	}
+	var unstable []coverage.Report
+	for _, r := range reports {
+		if !r.Stable {
+			unstable = append(unstable, r)
+		}
+	}
+	if len(unstable) == 0 {
+		fmt.Println("All workloads have stable observations.")
+		return
+	}
+	fmt.Printf("%d of %d workloads do not have stable observations yet (coverage.fixPolicy: %s):\n", len(unstable), len(reports), conf.Coverage.FixPolicy)
+	for _, r := range unstable {
+		fmt.Printf("  - %s/%s/%s: %s\n", r.Workload.Namespace, r.Workload.Kind, r.Workload.Name, r.Reason)
+	}
+}
+
+// printObservationSummary 按命名空间打印已采集的观测数据
+func printObservationSummary(since time.Time) {
+	summaries, err := db.SummarizeObservations(since)
+	if err != nil {
+		fmt.Printf("Error summarizing observations: %v\n", err)
+		return
+	}
+	fmt.Printf("Observed for %s. Metric samples are counted for this run, other observations for the whole session:\n", time.Since(since).Round(time.Second))
+	fmt.Printf("%-24s %6s %8s %6s %6s %9s %12s %10s\n", "NAMESPACE", "PODS", "METRICS", "FILES", "CAPS", "SYSCALLS", "CONNECTIONS", "PROCESSES")
+	for _, s := range summaries {
+		fmt.Printf("%-24s %6d %8d %6d %6d %9d %12d %10d\n", s.Namespace, s.Pods, s.MetricSamples, s.Files, s.Capabilities, s.Syscalls, s.Connections, s.Processes)
+	}
+	if stats, ok := falco.PipelineStats(); ok {
+		fmt.Printf("Falco alerts: %s\n", stats)
+		if stats.Dropped > 0 {
+			fmt.Println("Some observations were dropped, consider raising falco.queueSize or falco.batchSize.")
+		}
+	}
 }
 
 func init() {
+	addWriteSessionFlags(observeCmd)
 	rootCmd.AddCommand(observeCmd)
 }
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/fixer"
+	"kubefix-cli/pkg/netpol"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var processReportCmd = &cobra.Command{
+	Use:   "process-report",
+	Short: "Report the programs each container executed and whether it is ready for a distroless image",
+	Long: `List the programs every container in resourceDir executed while being observed.
+Containers that only ever ran their entrypoint are candidates for distroless images,
+allowPrivilegeEscalation: false and dropping all capabilities. Containers that spawned shells,
+package managers or network tools are flagged.`,
+	Run: processReport,
+}
+
+func processReport(cmd *cobra.Command, args []string) {
+	selectSessions()
+	if _, err := os.Stat(conf.ResourceDir); os.IsNotExist(err) {
+		fmt.Printf("Error: Input directory '%s' does not exist\n", conf.ResourceDir)
+		os.Exit(1)
+	}
+	files, err := filepath.Glob(filepath.Join(conf.ResourceDir, "*.yaml"))
+	if err != nil {
+		fmt.Printf("Error scanning input directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	var candidates, suspicious int
+	fmt.Printf("%-48s %-24s %-9s %s\n", "WORKLOAD", "CONTAINER", "PROGRAMS", "VERDICT")
+	for _, resourceFile := range files {
+		prefix := strings.TrimSuffix(filepath.Base(resourceFile), ".yaml")
+		content, err := os.ReadFile(resourceFile)
+		if err != nil {
+			fmt.Printf("error reading resource file %s: %v\n", resourceFile, err)
+			continue
+		}
+		workload, err := fixer.ParseManifest(content)
+		if err != nil || workload.PodSpec() == nil || workload.Kind() == "Pod" && netpol.ControllerManaged(workload.PodLabels()) {
+			continue
+		}
+		profiles, observed, err := fixer.ObservedProcesses(workload)
+		if err != nil {
+			fmt.Printf("%s: error reading observed processes: %v\n", prefix, err)
+			continue
+		}
+		if !observed {
+			continue
+		}
+		for _, p := range profiles {
+			fmt.Printf("%-48s %-24s %-9d %s\n", prefix, p.Container, len(p.Binaries), p.Verdict())
+			if p.EntrypointOnly {
+				candidates++
+			}
+			if p.Suspicious() {
+				suspicious++
+			}
+		}
+	}
+	fmt.Printf("\n%d containers only ran their entrypoint, %d spawned shells, package managers or network tools.\n", candidates, suspicious)
+	fmt.Println("Exec probes and lifecycle hooks are not counted. Entrypoint-only verdicts hold only for containers that started while being observed.")
+}
+
+func init() {
+	addReadSessionsFlag(processReportCmd)
+	rootCmd.AddCommand(processReportCmd)
+}
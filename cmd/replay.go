@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"kubefix-cli/pkg/falco"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <file>...",
+	Short: "Feed saved Falco alert logs through the observation pipeline",
+	Long: `Read Falco alerts saved from json_output, the Falco stdout log or collected webhook payloads,
+one JSON alert per line, and store their observations as observe would. Use - to read stdin.
+Observations are stored in the session given by --session.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  replay,
+}
+
+func replay(cmd *cobra.Command, args []string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	startSession(cmd)
+	defer endSession()
+
+	for _, path := range args {
+		var r io.Reader = os.Stdin
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				fmt.Printf("Error opening alert log '%s': %v\n", path, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			r = f
+		}
+		stats, err := falco.Replay(ctx, r)
+		if err != nil {
+			fmt.Printf("Error replaying '%s': %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Replayed %s: %s\n", path, stats)
+	}
+}
+
+func init() {
+	addWriteSessionFlags(replayCmd)
+	rootCmd.AddCommand(replayCmd)
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/fixer"
+	"kubefix-cli/pkg/seccomp"
+	"kubefix-cli/pkg/utils"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var seccompFormat string
+
+var seccompCmd = &cobra.Command{
+	Use:   "seccomp",
+	Short: "Generate seccomp profiles from observed syscalls and wire them into the fixed manifests",
+	Long: `Generate a seccomp profile for every container whose syscalls were observed.
+
+Syscalls are only fully recorded while the optional "kubefix syscall" Falco rule is enabled
+(falco-config --syscalls). Containers observed with it get a profile that denies every other
+syscall with EPERM; other containers get a complain-mode profile (SCMP_ACT_LOG) that only logs
+syscalls outside the observed set, because denying them would break the workload.
+
+With --format localhost, profiles are written to <seccompDir>/<namespace>/<name>.json and
+referenced as kubefix/<namespace>/<name>.json, so the directory must be copied to
+/var/lib/kubelet/seccomp/kubefix on every node.
+With --format crd, security-profiles-operator SeccompProfile objects are written to
+<seccompDir>/<name>.yaml and referenced through the path the operator installs them to.`,
+	Run: generateSeccomp,
+}
+
+func generateSeccomp(cmd *cobra.Command, args []string) {
+	selectSessions()
+	if seccompFormat != "localhost" && seccompFormat != "crd" {
+		fmt.Printf("Error: unknown format '%s', expected localhost or crd\n", seccompFormat)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(conf.ResourceDir); os.IsNotExist(err) {
+		fmt.Printf("Error: Input directory '%s' does not exist\n", conf.ResourceDir)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(conf.SeccompDir, 0755); err != nil {
+		fmt.Printf("Error creating seccomp directory '%s': %v\n", conf.SeccompDir, err)
+		os.Exit(1)
+	}
+	utils.CleanDirectory(conf.SeccompDir)
+	if err := os.MkdirAll(conf.FixDir, 0755); err != nil {
+		fmt.Printf("Error creating fix directory '%s': %v\n", conf.FixDir, err)
+		os.Exit(1)
+	}
+
+	files, err := filepath.Glob(filepath.Join(conf.ResourceDir, "*.yaml"))
+	if err != nil {
+		fmt.Printf("Error scanning input directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, resourceFile := range files {
+		prefix := strings.TrimSuffix(filepath.Base(resourceFile), ".yaml")
+		content, err := os.ReadFile(resourceFile)
+		if err != nil {
+			fmt.Printf("error reading resource file %s: %v\n", resourceFile, err)
+			continue
+		}
+		workload, err := fixer.ParseManifest(content)
+		if err != nil || workload.PodSpec() == nil {
+			continue
+		}
+
+		syscalls, complete, err := fixer.ObservedSyscalls(workload)
+		if err != nil {
+			fmt.Printf("%s: error reading observed syscalls: %v\n", prefix, err)
+			continue
+		}
+		if len(syscalls) == 0 {
+			fmt.Printf("%s: no syscalls observed, skipped\n", prefix)
+			continue
+		}
+
+		// Wire the profiles into the fixed manifest if there is one
+		fixedFilePath := filepath.Join(conf.FixDir, prefix+".yaml")
+		target := workload
+		if fixed, err := os.ReadFile(fixedFilePath); err == nil {
+			if target, err = fixer.ParseManifest(fixed); err != nil {
+				fmt.Printf("%s: error parsing fixed manifest: %v\n", prefix, err)
+				continue
+			}
+		}
+
+		for _, c := range workload.Containers(true) {
+			container, _ := c["name"].(string)
+			observed, ok := syscalls[container]
+			if !ok {
+				fmt.Printf("%s: no syscalls observed for container %s, skipped\n", prefix, container)
+				continue
+			}
+			name := fmt.Sprintf("%s-%s", prefix, container)
+			if !complete[container] {
+				fmt.Printf("%s: Warning: syscalls of container %s were not fully captured, generating a complain-mode profile that only logs other syscalls; "+
+					"enable the kubefix syscall rule with falco-config --syscalls and observe again to enforce it\n", prefix, container)
+			}
+			localhostProfile, err := writeSeccompProfile(seccomp.NewProfile(observed, complete[container]), workload.Namespace(), name)
+			if err != nil {
+				fmt.Printf("%s: error writing seccomp profile for container %s: %v\n", prefix, container, err)
+				continue
+			}
+			fixer.SetSeccompProfile(target, container, localhostProfile)
+			fmt.Printf("%s: generated seccomp profile %s\n", prefix, localhostProfile)
+		}
+
+		if !target.Modified {
+			continue
+		}
+		out, err := target.Bytes()
+		if err != nil {
+			fmt.Printf("%s: error marshaling manifest: %v\n", prefix, err)
+			continue
+		}
+		if err := os.WriteFile(fixedFilePath, out, 0644); err != nil {
+			fmt.Printf("error writing to fixed file %s: %v\n", fixedFilePath, err)
+		}
+	}
+
+	fmt.Printf("\nSeccomp profiles saved to: %s\n", conf.SeccompDir)
+}
+
+// writeSeccompProfile 按格式写出 profile，返回容器 seccompProfile.localhostProfile 应引用的路径
+func writeSeccompProfile(profile seccomp.Profile, namespace, name string) (string, error) {
+	if seccompFormat == "crd" {
+		out, err := yaml.Marshal(profile.CRD(namespace, name))
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(conf.SeccompDir, name+".yaml"), out, 0644); err != nil {
+			return "", err
+		}
+		return seccomp.CRDLocalhostProfile(namespace, name), nil
+	}
+
+	out, err := profile.JSON()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(conf.SeccompDir, namespace)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), out, 0644); err != nil {
+		return "", err
+	}
+	return "kubefix/" + namespace + "/" + name + ".json", nil
+}
+
+func init() {
+	seccompCmd.Flags().StringVar(&seccompFormat, "format", "localhost", "profile format: localhost or crd")
+	addReadSessionsFlag(seccompCmd)
+	rootCmd.AddCommand(seccompCmd)
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/db"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// readSessions 是读取观测数据的命令所限定的会话
+	readSessions []string
+	// writeSession 和 sessionCluster 是写入观测数据的命令所属的会话及其集群
+	writeSession   string
+	sessionCluster string
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "List, delete and compare observation sessions",
+	Long: `Every observe, replay and backfill run stores its observations in a session, identified by
+--session and tagged with the cluster and the time range of the run. Commands that read observations
+use all sessions unless --session selects one or more of them. Observations recorded before sessions
+were introduced are kept in the '` + db.LegacySession + `' session.`,
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List observation sessions",
+	Args:  cobra.NoArgs,
+	Run:   listSessions,
+}
+
+var sessionDeleteCmd = &cobra.Command{
+	Use:   "delete <session>...",
+	Short: "Delete observation sessions and all of their observations",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   deleteSessions,
+}
+
+var sessionCompareCmd = &cobra.Command{
+	Use:     "compare <old> <new>",
+	Aliases: []string{"diff"},
+	Short:   "Show capabilities and files observed in a session but not in an earlier one",
+	Long: `Compare two sessions per workload and container, across all pods of the workload, and list the
+capabilities and written files recorded in <new> that were not recorded in <old>.`,
+	Args: cobra.ExactArgs(2),
+	Run:  compareSessions,
+}
+
+func listSessions(cmd *cobra.Command, args []string) {
+	sessions, err := db.ListSessions()
+	if err != nil {
+		fmt.Printf("Error listing sessions: %v\n", err)
+		os.Exit(1)
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No sessions recorded yet.")
+		return
+	}
+	fmt.Printf("%-28s %-20s %-20s %-20s %9s %8s %6s %6s %9s\n", "SESSION", "CLUSTER", "STARTED", "ENDED", "WORKLOADS", "METRICS", "FILES", "CAPS", "INCIDENTS")
+	for _, s := range sessions {
+		ended := "running"
+		if !s.Ended.IsZero() {
+			ended = s.Ended.Local().Format(time.DateTime)
+		}
+		fmt.Printf("%-28s %-20s %-20s %-20s %9d %8d %6d %6d %9d\n", s.ID, orDash(s.Cluster), s.Started.Local().Format(time.DateTime), ended,
+			s.Workloads, s.MetricSamples, s.Files, s.Capabilities, s.Incidents)
+	}
+}
+
+func deleteSessions(cmd *cobra.Command, args []string) {
+	for _, id := range args {
+		if _, ok, err := db.GetSession(id); err != nil {
+			fmt.Printf("Error reading session '%s': %v\n", id, err)
+			os.Exit(1)
+		} else if !ok {
+			fmt.Printf("Error: session '%s' does not exist\n", id)
+			os.Exit(1)
+		}
+		deleted, err := db.DeleteSession(id)
+		if err != nil {
+			fmt.Printf("Error deleting session '%s': %v\n", id, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted session %s and %d observation records\n", id, deleted)
+	}
+}
+
+func compareSessions(cmd *cobra.Command, args []string) {
+	for _, id := range args {
+		if _, ok, err := db.GetSession(id); err != nil {
+			fmt.Printf("Error reading session '%s': %v\n", id, err)
+			os.Exit(1)
+		} else if !ok {
+			fmt.Printf("Error: session '%s' does not exist\n", id)
+			os.Exit(1)
+		}
+	}
+	diffs, err := db.DiffSessions(args[0], args[1])
+	if err != nil {
+		fmt.Printf("Error comparing sessions: %v\n", err)
+		os.Exit(1)
+	}
+	if len(diffs) == 0 {
+		fmt.Printf("No capabilities or files were observed in %s that were not observed in %s.\n", args[1], args[0])
+		return
+	}
+
+	var caps, files int
+	for _, d := range diffs {
+		fmt.Printf("%s/%s/%s container %s:\n", d.Workload.Namespace, d.Workload.Kind, d.Workload.Name, d.Container)
+		for _, c := range d.Capabilities {
+			fmt.Printf("  + capability %s\n", c)
+		}
+		for _, f := range d.Files {
+			fmt.Printf("  + file %s\n", f)
+		}
+		caps += len(d.Capabilities)
+		files += len(d.Files)
+	}
+	fmt.Printf("\n%d new capabilities and %d new files in %d containers observed in %s but not in %s.\n", caps, files, len(diffs), args[1], args[0])
+}
+
+// addReadSessionsFlag 为读取观测数据的命令添加 --session 参数
+func addReadSessionsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&readSessions, "session", nil, "only use observations from these sessions, comma separated (default all sessions)")
+}
+
+// selectSessions 检查 --session 指定的会话是否存在，并限定之后读取的观测数据为这些会话的并集
+func selectSessions() {
+	for _, id := range readSessions {
+		if _, ok, err := db.GetSession(id); err != nil {
+			fmt.Printf("Error reading session '%s': %v\n", id, err)
+			os.Exit(1)
+		} else if !ok {
+			fmt.Printf("Error: session '%s' does not exist, see 'kubefix-cli session list'\n", id)
+			os.Exit(1)
+		}
+	}
+	db.SelectSessions(readSessions)
+}
+
+// addWriteSessionFlags 为写入观测数据的命令添加 --session 和 --cluster 参数
+func addWriteSessionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&writeSession, "session", "", "session to store the observations in, an existing session is continued (default <command>-<start time>)")
+	cmd.Flags().StringVar(&sessionCluster, "cluster", "", "cluster the session is tagged with (default the cluster of the current kubeconfig context)")
+}
+
+// startSession 开始 --session 指定的会话，之后写入和读取的观测数据都属于这个会话
+func startSession(cmd *cobra.Command) {
+	id := writeSession
+	if id == "" {
+		id = cmd.Name() + "-" + time.Now().Format("20060102-150405")
+	}
+	cluster := sessionCluster
+	if cluster == "" {
+		// 无法读取 kubeconfig 时会话不记录集群
+		cluster, _ = client.ClusterName()
+	}
+	if err := db.StartSession(id, cluster); err != nil {
+		fmt.Printf("Error starting session '%s': %v\n", id, err)
+		os.Exit(1)
+	}
+	db.SelectSessions([]string{id})
+	fmt.Printf("Session: %s\n", id)
+}
+
+// endSession 记录会话的结束时间
+func endSession() {
+	if err := db.EndSession(); err != nil {
+		fmt.Printf("Error ending session: %v\n", err)
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionListCmd, sessionDeleteCmd, sessionCompareCmd)
+	rootCmd.AddCommand(sessionCmd)
+}
@@ -9,6 +9,100 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// LLMConfig 描述修复时使用的 LLM 提供方
+type LLMConfig struct {
+	Provider    string  `yaml:"provider"` // raw, openai 或 ollama
+	Endpoint    string  `yaml:"endpoint"` // 接口地址，raw 时默认使用 llmApi
+	Model       string  `yaml:"model"`    // 模型名称
+	Temperature float64 `yaml:"temperature"`
+	MaxTokens   int     `yaml:"maxTokens"`
+	APIKeyEnv   string  `yaml:"apiKeyEnv"` // 保存 API Key 的环境变量名
+	Timeout     int     `yaml:"timeout"`   // 单次请求超时，单位秒
+	Retries     int     `yaml:"retries"`   // 失败后的重试次数
+	Backoff     int     `yaml:"backoff"`   // 首次重试前的等待时间，单位秒，之后每次翻倍
+}
+
+// FalcoConfig 描述接收 Falco 告警的各个输入及写入队列
+type FalcoConfig struct {
+	Listen         string          `yaml:"listen"`         // HTTP 输入的监听地址，off 表示不启用
+	TLSCert        string          `yaml:"tlsCert"`        // 服务端证书，为空时使用 HTTP
+	TLSKey         string          `yaml:"tlsKey"`         // 服务端私钥
+	ClientCA       string          `yaml:"clientCA"`       // 校验客户端证书的 CA，设置后要求 mTLS
+	TokenEnv       string          `yaml:"tokenEnv"`       // 保存 Bearer Token 的环境变量名，设置后要求 Authorization 头
+	HMACSecretEnv  string          `yaml:"hmacSecretEnv"`  // 保存 HMAC 密钥的环境变量名，设置后要求请求体签名
+	HMACHeader     string          `yaml:"hmacHeader"`     // 携带 sha256=<十六进制签名> 的请求头
+	MaxBodyBytes   int64           `yaml:"maxBodyBytes"`   // 单个告警的最大字节数
+	QueueSize      int             `yaml:"queueSize"`      // 待写入观测的队列长度
+	BatchSize      int             `yaml:"batchSize"`      // 每次写入数据库的最大观测条数
+	FlushInterval  int             `yaml:"flushInterval"`  // 批次未满时的最长等待时间，单位毫秒
+	EnqueueTimeout int             `yaml:"enqueueTimeout"` // 队列满时等待空位的时间，单位毫秒，超时后丢弃并返回 503
+	TailFile       string          `yaml:"tailFile"`       // 持续读取的 Falco json_output 文件或标准输出日志，为空时不启用
+	TailFromStart  bool            `yaml:"tailFromStart"`  // 从文件开头而不是末尾开始读取
+	GRPC           FalcoGRPCConfig `yaml:"grpc"`
+}
+
+// FalcoGRPCConfig 描述如何订阅 Falco 的 gRPC outputs 服务
+type FalcoGRPCConfig struct {
+	Address    string `yaml:"address"`    // 例如 unix:///run/falco/falco.sock 或 falco:5060，为空时不启用
+	CACert     string `yaml:"caCert"`     // 校验 Falco 服务端证书的 CA，设置后使用 TLS
+	ClientCert string `yaml:"clientCert"` // mTLS 客户端证书
+	ClientKey  string `yaml:"clientKey"`  // mTLS 客户端私钥
+}
+
+// CoverageConfig 描述何时认为工作负载的观测已经稳定
+type CoverageConfig struct {
+	StableAfter    int    `yaml:"stableAfter"`    // 连续多少分钟没有新的 capability、文件或系统调用时视为稳定
+	MinSamples     int    `yaml:"minSamples"`     // 视为稳定所需的最少行为观测条数
+	MaxObserveTime int    `yaml:"maxObserveTime"` // observe 最长运行的分钟数，大于 observeTime 时运行 observeTime 后继续观测直到所有工作负载稳定
+	FixPolicy      string `yaml:"fixPolicy"`      // 观测未稳定时 fix 的处理方式：warn 仍然收紧并给出警告，refuse 不根据观测数据收紧
+}
+
+// TetragonConfig 描述如何读取 Tetragon 的 JSON 导出
+type TetragonConfig struct {
+	ExportFile string `yaml:"exportFile"` // Tetragon 的 JSON 导出文件，例如 /var/run/cilium/tetragon/tetragon.log，为空时不启用
+	FromStart  bool   `yaml:"fromStart"`  // 从文件开头而不是末尾开始读取
+}
+
+// MetricsConfig 描述指标的来源、保留与降采样
+type MetricsConfig struct {
+	Source         string           `yaml:"source"`         // metrics-server 或 prometheus
+	RawRetention   int              `yaml:"rawRetention"`   // 原始样本保留时长，单位小时，0 表示不降采样
+	RollupInterval int              `yaml:"rollupInterval"` // 降采样桶的宽度，单位分钟
+	Prometheus     PrometheusConfig `yaml:"prometheus"`
+}
+
+// PrometheusConfig 描述如何从 Prometheus HTTP API 读取容器指标
+type PrometheusConfig struct {
+	URL            string          `yaml:"url"`
+	BearerTokenEnv string          `yaml:"bearerTokenEnv"` // 保存 Bearer Token 的环境变量名
+	Timeout        int             `yaml:"timeout"`        // 单次查询超时，单位秒
+	Lookback       int             `yaml:"lookback"`       // 回填的历史时长，单位小时
+	Step           int             `yaml:"step"`           // 回填的采样间隔，单位秒
+	Queries        PrometheusQuery `yaml:"queries"`
+}
+
+// PrometheusQuery 是读取各项指标的 PromQL，$namespace 和 $window 会被替换为命名空间和回看窗口。
+// 使用量、限流和重启的查询结果需要带有 namespace、pod、container 标签
+type PrometheusQuery struct {
+	CPU             string `yaml:"cpu"`             // 毫核
+	Memory          string `yaml:"memory"`          // 字节
+	Throttling      string `yaml:"throttling"`      // 被限流的 CFS 周期占比，0 到 1
+	Restarts        string `yaml:"restarts"`        // 容器累计重启次数
+	PodOwner        string `yaml:"podOwner"`        // 带有 pod、owner_kind、owner_name 标签
+	ReplicaSetOwner string `yaml:"replicaSetOwner"` // 带有 replicaset、owner_kind、owner_name 标签
+	JobOwner        string `yaml:"jobOwner"`        // 带有 job_name、owner_kind、owner_name 标签
+}
+
+// ResourcesConfig 描述如何根据观测到的指标推荐资源请求与限制
+type ResourcesConfig struct {
+	Mode              string `yaml:"mode"`              // inject 直接写入清单，prompt 作为上下文交给 LLM
+	RequestPercentile int    `yaml:"requestPercentile"` // 计算 requests 使用的百分位，1 到 100
+	LimitPercentile   int    `yaml:"limitPercentile"`   // 计算 limits 使用的百分位，取值同上
+	Window            int    `yaml:"window"`            // 只使用最近多少小时的指标，0 表示全部
+	Headroom          int    `yaml:"headroom"`          // 在百分位基础上增加的余量，单位百分比
+	MinSamples        int    `yaml:"minSamples"`        // 样本数少于该值时不做推荐
+}
+
 var (
 	Kubeconfig       string
 	IgnoreNamespaces []string
@@ -18,7 +112,17 @@ var (
 	LintDir          string
 	FixDir           string
 	ValidateDir      string
+	SeccompDir       string
+	NetpolDir        string
+	FalcoConfigDir   string
 	LLMApi           string
+	FixRounds        int
+	LLM              LLMConfig
+	Resources        ResourcesConfig
+	Metrics          MetricsConfig
+	Falco            FalcoConfig
+	Tetragon         TetragonConfig
+	Coverage         CoverageConfig
 )
 
 func init() {
@@ -34,15 +138,25 @@ func init() {
 	}
 
 	var cfg struct {
-		Kubeconfig       string   `yaml:"kubeconfig"`
-		IgnoreNamespaces []string `yaml:"ignoreNamespaces"`
-		Database         string   `yaml:"database"`
-		ObserveTime      int      `yaml:"observeTime"`
-		ResourceDir      string   `yaml:"resourceDir"`
-		LintDir          string   `yaml:"lintDir"`
-		FixDir           string   `yaml:"fixDir"`
-		ValidateDir      string   `yaml:"validateDir"`
-		LLMApi           string   `yaml:"llmApi"`
+		Kubeconfig       string          `yaml:"kubeconfig"`
+		IgnoreNamespaces []string        `yaml:"ignoreNamespaces"`
+		Database         string          `yaml:"database"`
+		ObserveTime      int             `yaml:"observeTime"`
+		ResourceDir      string          `yaml:"resourceDir"`
+		LintDir          string          `yaml:"lintDir"`
+		FixDir           string          `yaml:"fixDir"`
+		ValidateDir      string          `yaml:"validateDir"`
+		SeccompDir       string          `yaml:"seccompDir"`
+		NetpolDir        string          `yaml:"netpolDir"`
+		FalcoConfigDir   string          `yaml:"falcoConfigDir"`
+		LLMApi           string          `yaml:"llmApi"`
+		FixRounds        int             `yaml:"fixRounds"`
+		LLM              LLMConfig       `yaml:"llm"`
+		Resources        ResourcesConfig `yaml:"resources"`
+		Metrics          MetricsConfig   `yaml:"metrics"`
+		Falco            FalcoConfig     `yaml:"falco"`
+		Tetragon         TetragonConfig  `yaml:"tetragon"`
+		Coverage         CoverageConfig  `yaml:"coverage"`
 	}
 
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
@@ -57,7 +171,107 @@ func init() {
 	LintDir = cfg.LintDir
 	FixDir = cfg.FixDir
 	ValidateDir = cfg.ValidateDir
+	SeccompDir = cfg.SeccompDir
+	NetpolDir = cfg.NetpolDir
+	FalcoConfigDir = cfg.FalcoConfigDir
+	if FalcoConfigDir == "" {
+		FalcoConfigDir = "./falco-config"
+	}
 	LLMApi = cfg.LLMApi
+	FixRounds = cfg.FixRounds
+	if FixRounds < 1 {
+		FixRounds = 1
+	}
+	LLM = cfg.LLM
+	if LLM.Provider == "" {
+		LLM.Provider = "raw"
+	}
+	if LLM.Endpoint == "" && LLM.Provider == "raw" {
+		LLM.Endpoint = LLMApi
+	}
+	if LLM.Timeout <= 0 {
+		LLM.Timeout = 300
+	}
+	if LLM.Backoff <= 0 {
+		LLM.Backoff = 1
+	}
+	Resources = cfg.Resources
+	if Resources.Mode == "" {
+		Resources.Mode = "prompt"
+	}
+	if Resources.RequestPercentile <= 0 {
+		Resources.RequestPercentile = 90
+	}
+	if Resources.LimitPercentile <= 0 {
+		Resources.LimitPercentile = 99
+	}
+	if Resources.RequestPercentile > 100 || Resources.LimitPercentile > 100 {
+		panic(fmt.Sprintf("resources.requestPercentile and resources.limitPercentile must be between 1 and 100, got %d and %d",
+			Resources.RequestPercentile, Resources.LimitPercentile))
+	}
+	if Resources.MinSamples <= 0 {
+		Resources.MinSamples = 5
+	}
+	Metrics = cfg.Metrics
+	if Metrics.Source == "" {
+		Metrics.Source = "metrics-server"
+	}
+	if Metrics.RollupInterval <= 0 {
+		Metrics.RollupInterval = 60
+	}
+	Tetragon = cfg.Tetragon
+	Coverage = cfg.Coverage
+	if Coverage.StableAfter <= 0 {
+		Coverage.StableAfter = 30
+	}
+	if Coverage.MinSamples <= 0 {
+		Coverage.MinSamples = 50
+	}
+	if Coverage.FixPolicy == "" {
+		Coverage.FixPolicy = "warn"
+	}
+	Falco = cfg.Falco
+	if Falco.Listen == "" {
+		Falco.Listen = ":8999"
+	}
+	if Falco.HMACHeader == "" {
+		Falco.HMACHeader = "X-Kubefix-Signature"
+	}
+	if Falco.MaxBodyBytes <= 0 {
+		Falco.MaxBodyBytes = 1 << 20
+	}
+	if Falco.QueueSize <= 0 {
+		Falco.QueueSize = 10000
+	}
+	if Falco.BatchSize <= 0 {
+		Falco.BatchSize = 500
+	}
+	if Falco.FlushInterval <= 0 {
+		Falco.FlushInterval = 1000
+	}
+	prom := &Metrics.Prometheus
+	if prom.Timeout <= 0 {
+		prom.Timeout = 30
+	}
+	if prom.Lookback <= 0 {
+		prom.Lookback = 24 * 7
+	}
+	if prom.Step <= 0 {
+		prom.Step = 60
+	}
+	defaultQuery(&prom.Queries.CPU, `sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{namespace="$namespace", container!="", container!="POD"}[5m])) * 1000`)
+	defaultQuery(&prom.Queries.Memory, `sum by (namespace, pod, container) (container_memory_working_set_bytes{namespace="$namespace", container!="", container!="POD"})`)
+	defaultQuery(&prom.Queries.Throttling, `sum by (namespace, pod, container) (rate(container_cpu_cfs_throttled_periods_total{namespace="$namespace", container!=""}[5m])) / sum by (namespace, pod, container) (rate(container_cpu_cfs_periods_total{namespace="$namespace", container!=""}[5m]))`)
+	defaultQuery(&prom.Queries.Restarts, `max by (namespace, pod, container) (kube_pod_container_status_restarts_total{namespace="$namespace"})`)
+	defaultQuery(&prom.Queries.PodOwner, `max by (pod, owner_kind, owner_name) (last_over_time(kube_pod_owner{namespace="$namespace", owner_is_controller="true"}[$window]))`)
+	defaultQuery(&prom.Queries.ReplicaSetOwner, `max by (replicaset, owner_kind, owner_name) (last_over_time(kube_replicaset_owner{namespace="$namespace"}[$window]))`)
+	defaultQuery(&prom.Queries.JobOwner, `max by (job_name, owner_kind, owner_name) (last_over_time(kube_job_owner{namespace="$namespace"}[$window]))`)
+}
+
+func defaultQuery(query *string, value string) {
+	if *query == "" {
+		*query = value
+	}
 }
 
 func CdRootDir(path string) {
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"fmt"
+	"kubefix-cli/conf"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClusterName 返回 kubeconfig 当前上下文所指向的集群名称
+func ClusterName() (string, error) {
+	kubeconfigPath := conf.Kubeconfig
+	if strings.HasPrefix(kubeconfigPath, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error getting user home directory: %v", err)
+		}
+		kubeconfigPath = filepath.Join(homeDir, kubeconfigPath[2:])
+	}
+
+	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return "", fmt.Errorf("error loading kubeconfig %s: %v", kubeconfigPath, err)
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return "", fmt.Errorf("current context %q not found in kubeconfig %s", config.CurrentContext, kubeconfigPath)
+	}
+	return context.Cluster, nil
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/db"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// incidentCollector 将 Pod 的容器状态和 core/v1 Event 转换为异常记录
+type incidentCollector struct {
+	owners *OwnerResolver
+}
+
+// ObserveIncidents 记录已有的和 ctx 结束前新发生的 OOMKilled、CrashLoopBackOff、探针失败、CPU 限流告警和调度失败。
+// 先列出当前的 Pod 和 Event，再从列出的版本开始 watch；watch 被关闭时返回错误以便重新开始
+func ObserveIncidents(ctx context.Context) error {
+	owners, err := NewOwnerResolver()
+	if err != nil {
+		return err
+	}
+	clientset := owners.clientset
+	c := &incidentCollector{owners: owners}
+
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	for i := range pods.Items {
+		c.recordPod(&pods.Items[i])
+	}
+	events, err := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+	for i := range events.Items {
+		c.recordEvent(&events.Items[i])
+	}
+
+	podWatch, err := clientset.CoreV1().Pods("").Watch(ctx, metav1.ListOptions{ResourceVersion: pods.ResourceVersion})
+	if err != nil {
+		return fmt.Errorf("failed to watch pods: %w", err)
+	}
+	defer podWatch.Stop()
+	eventWatch, err := clientset.CoreV1().Events("").Watch(ctx, metav1.ListOptions{ResourceVersion: events.ResourceVersion})
+	if err != nil {
+		return fmt.Errorf("failed to watch events: %w", err)
+	}
+	defer eventWatch.Stop()
+
+	fmt.Println("Watching pod statuses and events for incidents...")
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Incident collection stopped.")
+			return nil
+		case e, ok := <-podWatch.ResultChan():
+			if !ok {
+				return errors.New("pod watch closed")
+			}
+			if pod, ok := e.Object.(*corev1.Pod); ok && e.Type != watch.Deleted {
+				c.recordPod(pod)
+			}
+		case e, ok := <-eventWatch.ResultChan():
+			if !ok {
+				return errors.New("event watch closed")
+			}
+			if event, ok := e.Object.(*corev1.Event); ok && e.Type != watch.Deleted {
+				c.recordEvent(event)
+			}
+		}
+	}
+}
+
+// recordPod 记录容器上一次因 OOM 终止和当前处于 CrashLoopBackOff 的状态
+func (c *incidentCollector) recordPod(pod *corev1.Pod) {
+	if slices.Contains(conf.IgnoreNamespaces, pod.Namespace) {
+		return
+	}
+	limits := map[string]int64{}
+	for _, container := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		if limit, ok := container.Resources.Limits[corev1.ResourceMemory]; ok {
+			limits[container.Name] = limit.Value()
+		}
+	}
+	for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+			if terminated == nil || terminated.Reason != "OOMKilled" || terminated.FinishedAt.IsZero() {
+				continue
+			}
+			c.record(pod.Namespace, pod.Name, db.Incident{
+				Container:   status.Name,
+				Reason:      db.IncidentOOMKilled,
+				Message:     fmt.Sprintf("exit code %d after %d restarts", terminated.ExitCode, status.RestartCount),
+				MemoryLimit: limits[status.Name],
+				FirstSeen:   terminated.FinishedAt.Time,
+				LastSeen:    terminated.FinishedAt.Time,
+			})
+		}
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+			// 每次崩溃后的 CrashLoopBackOff 以上一次终止的时间区分，没有终止记录时以 Pod 的启动时间区分，
+			// 使同一次崩溃在每次状态更新时都对应同一条记录
+			seen := pod.CreationTimestamp.Time
+			if pod.Status.StartTime != nil {
+				seen = pod.Status.StartTime.Time
+			}
+			if last := status.LastTerminationState.Terminated; last != nil && !last.FinishedAt.IsZero() {
+				seen = last.FinishedAt.Time
+			}
+			c.record(pod.Namespace, pod.Name, db.Incident{
+				Container: status.Name,
+				Reason:    db.IncidentCrashLoopBackOff,
+				Message:   waiting.Message,
+				FirstSeen: seen,
+				LastSeen:  seen,
+			})
+		}
+	}
+}
+
+// recordEvent 记录与 Pod 相关的探针失败、CPU 限流告警和调度失败 Event。
+// 重启退避的 BackOff Event 与容器状态中的 CrashLoopBackOff 是同一次崩溃，只由 recordPod 记录
+func (c *incidentCollector) recordEvent(event *corev1.Event) {
+	if event.InvolvedObject.Kind != "Pod" || slices.Contains(conf.IgnoreNamespaces, event.Namespace) {
+		return
+	}
+	var reason string
+	switch {
+	case event.Reason == "Unhealthy":
+		reason = db.IncidentProbeFailure
+	case event.Reason == "FailedScheduling":
+		reason = db.IncidentFailedScheduling
+	case strings.Contains(strings.ToLower(event.Reason+" "+event.Message), "throttl"):
+		reason = db.IncidentCPUThrottling
+	default:
+		return
+	}
+
+	first, last := event.FirstTimestamp.Time, event.LastTimestamp.Time
+	count := int(event.Count)
+	if event.Series != nil {
+		count = max(count, int(event.Series.Count))
+		last = event.Series.LastObservedTime.Time
+	}
+	if first.IsZero() {
+		first = event.EventTime.Time
+	}
+	if first.IsZero() {
+		first = event.CreationTimestamp.Time
+	}
+	if last.IsZero() || last.Before(first) {
+		last = first
+	}
+	c.record(event.InvolvedObject.Namespace, event.InvolvedObject.Name, db.Incident{
+		Container: fieldPathContainer(event.InvolvedObject.FieldPath),
+		Reason:    reason,
+		Message:   event.Message,
+		Count:     count,
+		FirstSeen: first,
+		LastSeen:  last,
+	})
+}
+
+func (c *incidentCollector) record(namespace, pod string, incident db.Incident) {
+	incident.Pod = pod
+	workload, err := c.owners.Resolve(namespace, pod)
+	if err != nil {
+		fmt.Printf("Error resolving owner of pod %s in namespace %s: %v\n", pod, namespace, err)
+	}
+	incident.Workload = workload
+	if err := db.RecordIncident(incident); err != nil {
+		fmt.Printf("Error recording %s of pod %s/%s: %v\n", incident.Reason, namespace, pod, err)
+	}
+}
+
+// fieldPathContainer 从 spec.containers{name} 形式的字段路径中取出容器名称
+func fieldPathContainer(fieldPath string) string {
+	_, rest, ok := strings.Cut(fieldPath, "{")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "}")
+	return name
+}
@@ -29,12 +29,12 @@ func Namespaces() ([]string, error) {
 	return result, nil
 }
 
-func CollectNamespace() {
+// CollectNamespace 记录需要观测的命名空间，无法列出命名空间时返回错误
+func CollectNamespace(ctx context.Context) error {
 	fmt.Println("Collecting namespaces...")
 	namespaces, err := Namespaces()
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 	for _, ns := range namespaces {
 		err = db.InsertNamespace(ns)
@@ -43,4 +43,5 @@ func CollectNamespace() {
 		}
 	}
 	fmt.Println("Collecting namespaces finished.")
+	return nil
 }
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// OwnerResolver 沿 ownerReferences 将 Pod 解析为其顶层工作负载，并缓存解析结果
+type OwnerResolver struct {
+	clientset *kubernetes.Clientset
+
+	mu    sync.Mutex
+	cache map[string]model.Workload
+}
+
+func NewOwnerResolver() (*OwnerResolver, error) {
+	clientset, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	return &OwnerResolver{clientset: clientset, cache: map[string]model.Workload{}}, nil
+}
+
+// Resolve 返回 Pod 所属的顶层工作负载。Pod 已不存在时，将其自身视为工作负载并返回错误
+func (r *OwnerResolver) Resolve(namespace, pod string) (model.Workload, error) {
+	key := namespace + "/" + pod
+	r.mu.Lock()
+	w, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return w, nil
+	}
+
+	w, err := r.resolve(namespace, pod)
+	if err != nil {
+		return model.Workload{Namespace: namespace, Kind: "Pod", Name: pod}, err
+	}
+	r.mu.Lock()
+	r.cache[key] = w
+	r.mu.Unlock()
+	return w, nil
+}
+
+func (r *OwnerResolver) resolve(namespace, pod string) (model.Workload, error) {
+	ctx := context.TODO()
+	p, err := r.clientset.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return model.Workload{}, fmt.Errorf("failed to get pod %s/%s: %w", namespace, pod, err)
+	}
+
+	w := model.Workload{Namespace: namespace, Kind: "Pod", Name: pod}
+	owner := metav1.GetControllerOf(p)
+	for owner != nil {
+		w.Kind, w.Name = owner.Kind, owner.Name
+
+		var meta metav1.Object
+		switch owner.Kind {
+		case "ReplicaSet":
+			meta, err = r.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		case "Job":
+			meta, err = r.clientset.BatchV1().Jobs(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		default:
+			// StatefulSet、DaemonSet、Deployment、CronJob 等已是顶层工作负载
+			return w, nil
+		}
+		if err != nil {
+			// 旧版本的 ReplicaSet 可能已被清理，其名称为 <deployment>-<pod-template-hash>
+			hash := p.Labels["pod-template-hash"]
+			if owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+				w.Kind, w.Name = "Deployment", strings.TrimSuffix(owner.Name, "-"+hash)
+			}
+			// 其余情况停在已知的最上层
+			return w, nil
+		}
+		owner = metav1.GetControllerOf(meta)
+	}
+	return w, nil
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// peerRefreshInterval 是解析失败时重新列出 Pod 和 Service 的最短间隔
+const peerRefreshInterval = 30 * time.Second
+
+// Peer 是连接对端在连接发生时的身份
+type Peer struct {
+	Namespace string            // 对端所在命名空间，不是集群内的 Pod 时为空
+	Labels    map[string]string // 对端 Pod 的标签，经由 Service 访问时为 Service 的 selector
+	Service   string            // 经由 Service 访问时的 Service 名称
+	Addresses []string          // 对端不是 Pod 时实际接收连接的地址，例如 kubernetes Service 背后的 API server
+	Port      string            // 经由 Service 转发后的目标端口，可以是命名端口，未转发时为空
+}
+
+// PeerResolver 根据集群状态将 IP 解析为 Pod、Service 和命名空间。
+// 应在观测期间使用：Pod IP 会随 Pod 重建而变化，事后解析会得到错误的对端
+type PeerResolver struct {
+	clientset *kubernetes.Clientset
+
+	mu        sync.Mutex
+	refreshed time.Time
+	pods      map[string]*corev1.Pod
+	services  map[string]*corev1.Service
+	endpoints map[string][]discoveryv1.EndpointSlice // 按命名空间/Service 名称索引
+}
+
+// NewPeerResolver 列出集群中所有的 Pod 和 Service 并建立 IP 索引
+func NewPeerResolver() (*PeerResolver, error) {
+	clientset, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	r := &PeerResolver{clientset: clientset}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *PeerResolver) refresh() error {
+	ctx := context.TODO()
+	pods, err := r.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	services, err := r.clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	slices, err := r.clientset.DiscoveryV1().EndpointSlices("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list endpoint slices: %w", err)
+	}
+
+	r.refreshed = time.Now()
+	r.pods, r.services, r.endpoints = map[string]*corev1.Pod{}, map[string]*corev1.Service{}, map[string][]discoveryv1.EndpointSlice{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// hostNetwork 的 Pod 与节点共享 IP，无法区分
+		if pod.Spec.HostNetwork {
+			continue
+		}
+		for _, ip := range pod.Status.PodIPs {
+			r.pods[ip.IP] = pod
+		}
+	}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		for _, ip := range svc.Spec.ClusterIPs {
+			if ip != "" && ip != corev1.ClusterIPNone {
+				r.services[ip] = svc
+			}
+		}
+	}
+	for _, s := range slices.Items {
+		if name := s.Labels[discoveryv1.LabelServiceName]; name != "" {
+			key := s.Namespace + "/" + name
+			r.endpoints[key] = append(r.endpoints[key], s)
+		}
+	}
+	return nil
+}
+
+// Resolve 解析对端 IP 和端口。访问 Service 的 ClusterIP 时，返回其选中的 Pod 以及转发后的目标端口；
+// 没有 selector 的 Service（例如 kubernetes）返回其 Endpoints 的地址和端口。
+// 无法解析时距上次列出超过 peerRefreshInterval 则重新列出，仍无法解析时 ok 为 false
+func (r *PeerResolver) Resolve(ip string, port int, protocol string) (peer Peer, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if peer, ok = r.lookup(ip, port, protocol); ok || time.Since(r.refreshed) < peerRefreshInterval {
+		return peer, ok
+	}
+	if err := r.refresh(); err != nil {
+		fmt.Printf("Failed to refresh peer resolver: %v\n", err)
+		return peer, false
+	}
+	return r.lookup(ip, port, protocol)
+}
+
+func (r *PeerResolver) lookup(ip string, port int, protocol string) (Peer, bool) {
+	if pod, ok := r.pods[ip]; ok {
+		return Peer{Namespace: pod.Namespace, Labels: pod.Labels}, true
+	}
+	svc, ok := r.services[ip]
+	if !ok {
+		return Peer{}, false
+	}
+	var servicePort *corev1.ServicePort
+	for i, sp := range svc.Spec.Ports {
+		if int(sp.Port) == port && strings.EqualFold(string(sp.Protocol), protocol) {
+			servicePort = &svc.Spec.Ports[i]
+		}
+	}
+
+	peer := Peer{Namespace: svc.Namespace, Service: svc.Name}
+	if len(svc.Spec.Selector) > 0 {
+		peer.Labels = svc.Spec.Selector
+		// 未设置 targetPort 时与 port 相同
+		if servicePort != nil && servicePort.TargetPort.String() != "0" {
+			peer.Port = servicePort.TargetPort.String()
+		}
+		return peer, true
+	}
+
+	// 没有 selector 的 Service 的流量在 DNAT 后发往其 Endpoints，NetworkPolicy 只能按这些地址和端口匹配
+	for _, s := range r.endpoints[svc.Namespace+"/"+svc.Name] {
+		for _, ep := range s.Endpoints {
+			peer.Addresses = append(peer.Addresses, ep.Addresses...)
+		}
+		for _, ep := range s.Ports {
+			if servicePort != nil && ep.Port != nil && ptrString(ep.Name) == servicePort.Name {
+				peer.Port = fmt.Sprint(*ep.Port)
+			}
+		}
+	}
+	if len(peer.Addresses) == 0 {
+		return Peer{}, false
+	}
+	return peer, true
+}
+
+func ptrString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
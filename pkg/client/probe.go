@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodProber 通过 API Server 的 Pod 代理访问 Pod 的端口，代替 kubelet 验证 HTTP 探针是否可用
+type PodProber struct {
+	clientset *kubernetes.Clientset
+}
+
+func NewPodProber() (*PodProber, error) {
+	clientset, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	return &PodProber{clientset: clientset}, nil
+}
+
+// Services 返回命名空间中的 Service
+func (p *PodProber) Services(ctx context.Context, namespace string) ([]corev1.Service, error) {
+	services, err := p.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services in %s: %w", namespace, err)
+	}
+	return services.Items, nil
+}
+
+// ProbeHTTP 对 Pod 端口上的路径发起 GET 请求并返回状态码。Pod 不存在或端口不可达时返回错误
+func (p *PodProber) ProbeHTTP(ctx context.Context, namespace, pod string, port int, path string) (int, error) {
+	var status int
+	result := p.clientset.CoreV1().RESTClient().Get().
+		Namespace(namespace).Resource("pods").Name(pod + ":" + strconv.Itoa(port)).
+		SubResource("proxy").Suffix(path).Do(ctx)
+	result.StatusCode(&status)
+	if status == 0 {
+		return 0, fmt.Errorf("probe %s/%s:%d%s: %w", namespace, pod, port, path, result.Error())
+	}
+	return status, nil
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Workloads 返回需要观测的命名空间中的顶层工作负载：Deployment、StatefulSet、DaemonSet、CronJob，
+// 以及不属于其他控制器的 Job 和 Pod，与 OwnerResolver 解析出的工作负载一致
+func Workloads(ctx context.Context) ([]model.Workload, error) {
+	clientset, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := Namespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.Workload
+	add := func(kind string, meta metav1.Object) {
+		if kind == "Job" || kind == "Pod" {
+			if metav1.GetControllerOf(meta) != nil {
+				return
+			}
+		}
+		result = append(result, model.Workload{Namespace: meta.GetNamespace(), Kind: kind, Name: meta.GetName()})
+	}
+	for _, ns := range namespaces {
+		opts := metav1.ListOptions{}
+		deployments, err := clientset.AppsV1().Deployments(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments in %s: %w", ns, err)
+		}
+		for i := range deployments.Items {
+			add("Deployment", &deployments.Items[i])
+		}
+		statefulSets, err := clientset.AppsV1().StatefulSets(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list statefulsets in %s: %w", ns, err)
+		}
+		for i := range statefulSets.Items {
+			add("StatefulSet", &statefulSets.Items[i])
+		}
+		daemonSets, err := clientset.AppsV1().DaemonSets(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list daemonsets in %s: %w", ns, err)
+		}
+		for i := range daemonSets.Items {
+			add("DaemonSet", &daemonSets.Items[i])
+		}
+		cronJobs, err := clientset.BatchV1().CronJobs(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cronjobs in %s: %w", ns, err)
+		}
+		for i := range cronJobs.Items {
+			add("CronJob", &cronJobs.Items[i])
+		}
+		jobs, err := clientset.BatchV1().Jobs(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list jobs in %s: %w", ns, err)
+		}
+		for i := range jobs.Items {
+			add("Job", &jobs.Items[i])
+		}
+		pods, err := clientset.CoreV1().Pods(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods in %s: %w", ns, err)
+		}
+		for i := range pods.Items {
+			add("Pod", &pods.Items[i])
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+// Package coverage judges whether the observations of each workload are stable enough to tighten it
+package coverage
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/model"
+	"time"
+)
+
+// Report 是一个工作负载的覆盖情况及是否已经稳定，Reason 说明未稳定的原因
+type Report struct {
+	db.Coverage
+	Observed bool
+	Stable   bool
+	Reason   string
+}
+
+// Evaluate 按 conf.Coverage 判断覆盖情况是否稳定：行为观测达到 MinSamples 条，
+// 且连续 StableAfter 分钟没有新的 capability、文件或系统调用
+func Evaluate(c db.Coverage, observed bool, now time.Time) Report {
+	r := Report{Coverage: c, Observed: observed}
+	stableAfter := time.Duration(conf.Coverage.StableAfter) * time.Minute
+	switch {
+	case !observed:
+		r.Reason = "never observed"
+	case c.Samples < int64(conf.Coverage.MinSamples):
+		r.Reason = fmt.Sprintf("%d of %d samples", c.Samples, conf.Coverage.MinSamples)
+	case r.SinceLastNew(now) < stableAfter:
+		r.Reason = fmt.Sprintf("new behaviour %s ago", r.SinceLastNew(now).Round(time.Second))
+	default:
+		r.Stable = true
+	}
+	return r
+}
+
+// SinceLastNew 返回距最近一次新发现的时间，从未有新发现时返回距首次观测的时间
+func (r Report) SinceLastNew(now time.Time) time.Duration {
+	if r.LastNew.IsZero() {
+		return now.Sub(r.FirstSeen)
+	}
+	return now.Sub(r.LastNew)
+}
+
+// Status 返回工作负载当前的覆盖情况
+func Status(workload model.Workload) (Report, error) {
+	c, observed, err := db.GetCoverage(workload)
+	if err != nil {
+		return Report{}, err
+	}
+	c.Workload = workload
+	return Evaluate(c, observed, time.Now()), nil
+}
+
+// Cluster 返回集群中所有需要观测的工作负载的覆盖情况，包括从未被观测到的工作负载
+func Cluster(ctx context.Context) ([]Report, error) {
+	workloads, err := client.Workloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(workloads))
+	for _, w := range workloads {
+		r, err := Status(w)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// WaitForStability 在 minimum 之后每分钟检查一次集群中所有工作负载的覆盖情况，全部稳定时返回 true；
+// ctx 结束时返回 false
+func WaitForStability(ctx context.Context, minimum time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(minimum):
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		reports, err := Cluster(ctx)
+		if err != nil {
+			fmt.Printf("Error checking observation coverage: %v\n", err)
+		} else {
+			unstable := 0
+			for _, r := range reports {
+				if !r.Stable {
+					unstable++
+				}
+			}
+			if unstable == 0 {
+				return true
+			}
+			fmt.Printf("%d of %d workloads are not stable yet, continuing to observe...\n", unstable, len(reports))
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
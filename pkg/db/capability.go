@@ -3,45 +3,33 @@ package db
 import (
 	"context"
 	"fmt"
-	"slices"
+	"kubefix-cli/pkg/model"
 )
 
 func init() {
 	pool := dbPool()
 	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS capability (pod TEXT NOT NULL,namespace TEXT NOT NULL,caps TEXT[])")
 	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_capability_pod ON capability(pod)")
+	addWorkloadColumns("capability")
+	addContainerColumn("capability")
+	// WriteObservations 依赖 (pod, namespace, container, session) 上的唯一约束
+	pool.Exec(context.Background(), "DROP INDEX IF EXISTS idx_capability_pod_namespace")
+	addSessionColumn("capability", "pod, namespace, container")
+	pool.Exec(context.Background(), "DROP INDEX IF EXISTS idx_capability_pod_container")
 }
 
-func UpdateCaps(pod, namespace, cap string) error {
+// GetCapsByWorkload 返回工作负载所有副本及历代 Pod 按容器汇总的 capabilities
+func GetCapsByWorkload(workload model.Workload) (map[string][]string, error) {
 	pool := dbPool()
-	caps, err := GetCaps(pod, namespace)
+	query := `SELECT container, array_agg(DISTINCT c ORDER BY c) FROM capability, unnest(caps) AS c
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + ` GROUP BY container`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("GetCapsByWorkload query failed: %w", err)
 	}
-	if slices.Contains(caps, cap) {
-		return nil // cap already exists, no need to update
-	}
-	caps = append(caps, cap)
-	query := `INSERT INTO capability (pod, namespace, caps) VALUES ($1, $2, $3) ON CONFLICT (pod, namespace) DO UPDATE SET caps = $3`
-	_, err = pool.Exec(context.Background(), query, pod, namespace, caps)
-	if err != nil {
-		return fmt.Errorf("UpdateCaps failed: %w", err)
-	}
-	return nil
-}
-
-func GetCaps(pod, namespace string) ([]string, error) {
-	pool := dbPool()
-	query := `SELECT caps FROM capability WHERE pod = $1 AND namespace = $2`
-	row := pool.QueryRow(context.Background(), query, pod, namespace)
-
-	var caps []string
-	err := row.Scan(&caps)
+	caps, err := collectByContainer(rows)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return []string{}, nil // No syscall found for this pod and namespace
-		}
-		return []string{}, fmt.Errorf("GetCaps query failed: %w", err)
+		return nil, fmt.Errorf("GetCapsByWorkload scan failed: %w", err)
 	}
 	return caps, nil
 }
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+)
+
+const (
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS connection (pod TEXT NOT NULL,namespace TEXT NOT NULL,direction TEXT NOT NULL,peer_ip TEXT NOT NULL,port INTEGER NOT NULL,protocol TEXT NOT NULL)")
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_connection_pod ON connection(pod)")
+	addWorkloadColumns("connection")
+	addSessionColumn("connection", "pod, namespace, direction, peer_ip, port, protocol")
+	pool.Exec(context.Background(), "ALTER TABLE connection DROP CONSTRAINT IF EXISTS connection_pod_namespace_direction_peer_ip_port_protocol_key")
+	// 对端在连接发生时解析出的身份，旧数据没有解析结果
+	pool.Exec(context.Background(), `ALTER TABLE connection ADD COLUMN IF NOT EXISTS peer_namespace TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS peer_labels JSONB NOT NULL DEFAULT '{}', ADD COLUMN IF NOT EXISTS peer_service TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS peer_addresses TEXT[] NOT NULL DEFAULT '{}', ADD COLUMN IF NOT EXISTS peer_port TEXT NOT NULL DEFAULT ''`)
+}
+
+// Connection 是一条观测到的网络连接，ingress 时 Port 为本地监听端口，egress 时为对端端口。
+// Peer 为连接发生时解析出的对端，无法解析（例如集群外的地址）时为零值
+type Connection struct {
+	Pod       string
+	Workload  model.Workload
+	Direction string
+	PeerIP    string
+	Port      int
+	Protocol  string
+	Peer      ConnectionPeer
+}
+
+// ConnectionPeer 是连接对端在连接发生时的身份
+type ConnectionPeer struct {
+	Namespace string            // 对端所在命名空间
+	Labels    map[string]string // 对端 Pod 的标签，经由 Service 访问时为 Service 的 selector
+	Service   string            // 经由 Service 访问时的 Service 名称
+	Addresses []string          // 对端不是 Pod 时实际接收连接的地址，例如 kubernetes Service 背后的 API server
+	Port      string            // 经由 Service 转发后的目标端口，未转发时为空
+}
+
+// Resolved 返回对端是否被解析为集群内的对象
+func (p ConnectionPeer) Resolved() bool {
+	return p.Namespace != ""
+}
+
+const insertConnectionQuery = `INSERT INTO connection (pod, namespace, direction, peer_ip, port, protocol, workload_kind, workload_name, session,
+	peer_namespace, peer_labels, peer_service, peer_addresses, peer_port) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) ON CONFLICT DO NOTHING`
+
+// insertArgs 返回 insertConnectionQuery 的参数
+func (c Connection) insertArgs() []any {
+	labels := c.Peer.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	addresses := c.Peer.Addresses
+	if addresses == nil {
+		addresses = []string{}
+	}
+	return []any{c.Pod, c.Workload.Namespace, c.Direction, c.PeerIP, c.Port, c.Protocol, c.Workload.Kind, c.Workload.Name, currentSession,
+		c.Peer.Namespace, labels, c.Peer.Service, addresses, c.Peer.Port}
+}
+
+// GetConnectionsByWorkload 返回工作负载所有副本及历代 Pod 的连接记录
+func GetConnectionsByWorkload(workload model.Workload) ([]Connection, error) {
+	pool := dbPool()
+	query := `SELECT pod, direction, peer_ip, port, protocol, peer_namespace, peer_labels, peer_service, peer_addresses, peer_port
+		FROM connection WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + `
+		ORDER BY direction, peer_ip, port`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetConnectionsByWorkload query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var conns []Connection
+	for rows.Next() {
+		c := Connection{Workload: workload}
+		if err := rows.Scan(&c.Pod, &c.Direction, &c.PeerIP, &c.Port, &c.Protocol,
+			&c.Peer.Namespace, &c.Peer.Labels, &c.Peer.Service, &c.Peer.Addresses, &c.Peer.Port); err != nil {
+			return nil, fmt.Errorf("GetConnectionsByWorkload scan failed: %w", err)
+		}
+		conns = append(conns, c)
+	}
+	return conns, rows.Err()
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), `CREATE TABLE IF NOT EXISTS coverage (namespace TEXT NOT NULL,workload_kind TEXT NOT NULL,workload_name TEXT NOT NULL,
+		first_seen TIMESTAMP NOT NULL,last_seen TIMESTAMP NOT NULL,samples BIGINT NOT NULL DEFAULT 0,last_new TIMESTAMP)`)
+	// 每个会话分别记录覆盖情况，读取时汇总所选会话
+	addSessionColumn("coverage", "namespace, workload_kind, workload_name")
+	pool.Exec(context.Background(), "ALTER TABLE coverage DROP CONSTRAINT IF EXISTS coverage_pkey")
+}
+
+// Coverage 是一个工作负载的观测覆盖情况。Samples 为收到的行为观测条数（包括重复的），
+// LastNew 为最近一次记录到新的 capability、文件或系统调用的时间，从未记录到时为零值
+type Coverage struct {
+	Workload  model.Workload
+	FirstSeen time.Time
+	LastSeen  time.Time
+	LastNew   time.Time
+	Samples   int64
+}
+
+const updateCoverageQuery = `INSERT INTO coverage (namespace, workload_kind, workload_name, first_seen, last_seen, samples, last_new, session)
+	VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
+	ON CONFLICT (namespace, workload_kind, workload_name, session) DO UPDATE
+	SET last_seen = GREATEST(coverage.last_seen, EXCLUDED.last_seen), samples = coverage.samples + EXCLUDED.samples,
+		last_new = GREATEST(coverage.last_new, EXCLUDED.last_new)`
+
+// queueCoverage 为每个工作负载加入一条更新覆盖情况的语句，novel 中的工作负载的 last_new 更新为 seen。
+// TIMESTAMP 列不保存时区，seen 应为 UTC 时间，读取时才能与当前时间比较
+func queueCoverage(b *pgx.Batch, samples map[model.Workload]int64, novel map[model.Workload]bool, seen time.Time) {
+	workloads := map[model.Workload]bool{}
+	for w := range samples {
+		workloads[w] = true
+	}
+	for w := range novel {
+		workloads[w] = true
+	}
+	for w := range workloads {
+		var lastNew *time.Time
+		if novel[w] {
+			lastNew = &seen
+		}
+		b.Queue(updateCoverageQuery, w.Namespace, w.Kind, w.Name, seen, samples[w], lastNew, currentSession)
+	}
+}
+
+// GetCoverage 返回工作负载在所选会话中的观测覆盖情况，从未观测到时 ok 为 false
+func GetCoverage(workload model.Workload) (c Coverage, ok bool, err error) {
+	pool := dbPool()
+	query := `SELECT min(first_seen), max(last_seen), coalesce(max(last_new), '0001-01-01'::timestamp), sum(samples)::BIGINT FROM coverage
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + ` HAVING count(*) > 0`
+	c.Workload = workload
+	err = pool.QueryRow(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions).Scan(&c.FirstSeen, &c.LastSeen, &c.LastNew, &c.Samples)
+	if err == pgx.ErrNoRows {
+		return c, false, nil
+	}
+	if err != nil {
+		return c, false, fmt.Errorf("GetCoverage failed: %w", err)
+	}
+	return c, true, nil
+}
+
+// ListCoverage 返回所有工作负载在所选会话中的观测覆盖情况
+func ListCoverage() ([]Coverage, error) {
+	pool := dbPool()
+	query := `SELECT namespace, workload_kind, workload_name, min(first_seen), max(last_seen), coalesce(max(last_new), '0001-01-01'::timestamp), sum(samples)::BIGINT
+		FROM coverage WHERE ` + sessionFilter(1) + `
+		GROUP BY namespace, workload_kind, workload_name ORDER BY namespace, workload_kind, workload_name`
+	rows, err := pool.Query(context.Background(), query, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("ListCoverage query failed: %w", err)
+	}
+	defer rows.Close()
+	var result []Coverage
+	for rows.Next() {
+		var c Coverage
+		if err := rows.Scan(&c.Workload.Namespace, &c.Workload.Kind, &c.Workload.Name, &c.FirstSeen, &c.LastSeen, &c.LastNew, &c.Samples); err != nil {
+			return nil, fmt.Errorf("ListCoverage scan failed: %w", err)
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
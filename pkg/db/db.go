@@ -32,6 +32,19 @@ func dbPool() *pgxpool.Pool {
 	return pool
 }
 
+// addWorkloadColumns 为观测表添加所属工作负载的列，使观测数据可以跨副本和 Pod 版本汇总
+func addWorkloadColumns(table string) {
+	pool := dbPool()
+	pool.Exec(context.Background(), "ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS workload_kind TEXT NOT NULL DEFAULT '', ADD COLUMN IF NOT EXISTS workload_name TEXT NOT NULL DEFAULT ''")
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_"+table+"_workload ON "+table+"(namespace, workload_kind, workload_name)")
+}
+
+// addContainerColumn 为观测表添加容器列，旧数据的容器为空字符串，表示所属容器未知
+func addContainerColumn(table string) {
+	pool := dbPool()
+	pool.Exec(context.Background(), "ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS container TEXT NOT NULL DEFAULT ''")
+}
+
 // ClosePool 关闭数据库连接池
 func ClosePool() {
 	if pool != nil {
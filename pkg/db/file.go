@@ -3,45 +3,33 @@ package db
 import (
 	"context"
 	"fmt"
-	"slices"
+	"kubefix-cli/pkg/model"
 )
 
 func init() {
 	pool := dbPool()
 	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS file (pod TEXT NOT NULL,namespace TEXT NOT NULL,files TEXT[],UNIQUE(pod, namespace))")
 	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_file_pod ON file(pod)")
+	addWorkloadColumns("file")
+	addContainerColumn("file")
+	// WriteObservations 依赖 (pod, namespace, container, session) 上的唯一约束
+	pool.Exec(context.Background(), "ALTER TABLE file DROP CONSTRAINT IF EXISTS file_pod_namespace_key")
+	addSessionColumn("file", "pod, namespace, container")
+	pool.Exec(context.Background(), "DROP INDEX IF EXISTS idx_file_pod_container")
 }
 
-func UpdateFiles(pod, namespace, file string) error {
+// GetFilesByWorkload 返回工作负载所有副本及历代 Pod 按容器汇总的写入文件
+func GetFilesByWorkload(workload model.Workload) (map[string][]string, error) {
 	pool := dbPool()
-	files, err := GetFiles(pod, namespace)
+	query := `SELECT container, array_agg(DISTINCT f ORDER BY f) FROM file, unnest(files) AS f
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + ` GROUP BY container`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("GetFilesByWorkload query failed: %w", err)
 	}
-	if slices.Contains(files, file) {
-		return nil
-	}
-	files = append(files, file)
-	query := `INSERT INTO file (pod, namespace, files) VALUES ($1, $2, $3) ON CONFLICT (pod, namespace) DO UPDATE SET files = $3`
-	_, err = pool.Exec(context.Background(), query, pod, namespace, files)
-	if err != nil {
-		return fmt.Errorf("UpdateFiles failed: %w", err)
-	}
-	return nil
-}
-
-func GetFiles(pod, namespace string) ([]string, error) {
-	pool := dbPool()
-	query := `SELECT files FROM file WHERE pod = $1 AND namespace = $2`
-	row := pool.QueryRow(context.Background(), query, pod, namespace)
-
-	var files []string
-	err := row.Scan(&files)
+	files, err := collectByContainer(rows)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return []string{}, nil // No files found for this pod and namespace
-		}
-		return []string{}, err // Return the error if it's not "no rows"
+		return nil, fmt.Errorf("GetFilesByWorkload scan failed: %w", err)
 	}
-	return files, nil // Return the list of files
+	return files, nil
 }
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS identity (pod TEXT NOT NULL,namespace TEXT NOT NULL,container TEXT NOT NULL,users TEXT[],writers TEXT[])")
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_identity_pod ON identity(pod)")
+	addWorkloadColumns("identity")
+	addSessionColumn("identity", "pod, namespace, container")
+	pool.Exec(context.Background(), "ALTER TABLE identity DROP CONSTRAINT IF EXISTS identity_pod_namespace_container_key")
+}
+
+// Identity 是进程的有效用户和组，GID 为 -1 表示未知
+type Identity struct {
+	UID int64
+	GID int64
+}
+
+// ParseIdentity 解析 uid:gid 形式的身份，gid 可以为空
+func ParseIdentity(s string) (Identity, error) {
+	uid, gid, _ := strings.Cut(s, ":")
+	id := Identity{GID: -1}
+	var err error
+	if id.UID, err = strconv.ParseInt(uid, 10, 64); err != nil {
+		return id, fmt.Errorf("invalid uid in identity %q", s)
+	}
+	if gid != "" {
+		if id.GID, err = strconv.ParseInt(gid, 10, 64); err != nil {
+			return id, fmt.Errorf("invalid gid in identity %q", s)
+		}
+	}
+	return id, nil
+}
+
+func (id Identity) String() string {
+	if id.GID < 0 {
+		return strconv.FormatInt(id.UID, 10) + ":"
+	}
+	return fmt.Sprintf("%d:%d", id.UID, id.GID)
+}
+
+// ContainerIdentities 是容器中进程运行时的身份，以及写入文件时的身份，即其创建的文件的所有者
+type ContainerIdentities struct {
+	Users   []Identity
+	Writers []Identity
+}
+
+// GetIdentitiesByWorkload 返回工作负载所有副本及历代 Pod 按容器汇总的进程身份
+func GetIdentitiesByWorkload(workload model.Workload) (map[string]ContainerIdentities, error) {
+	pool := dbPool()
+	result := map[string]ContainerIdentities{}
+	for _, column := range []string{"users", "writers"} {
+		query := fmt.Sprintf(`SELECT container, array_agg(DISTINCT v ORDER BY v) FROM identity, unnest(%s) AS v
+			WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %s GROUP BY container`, column, sessionFilter(4))
+		rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
+		if err != nil {
+			return nil, fmt.Errorf("GetIdentitiesByWorkload query failed: %w", err)
+		}
+		values, err := collectByContainer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetIdentitiesByWorkload scan failed: %w", err)
+		}
+		for container, list := range values {
+			ids := result[container]
+			for _, v := range list {
+				id, err := ParseIdentity(v)
+				if err != nil {
+					return nil, err
+				}
+				if column == "users" {
+					ids.Users = append(ids.Users, id)
+				} else {
+					ids.Writers = append(ids.Writers, id)
+				}
+			}
+			result[container] = ids
+		}
+	}
+	for container, ids := range result {
+		slices.SortFunc(ids.Users, compareIdentity)
+		slices.SortFunc(ids.Writers, compareIdentity)
+		result[container] = ids
+	}
+	return result, nil
+}
+
+func compareIdentity(a, b Identity) int {
+	if a.UID != b.UID {
+		return int(a.UID - b.UID)
+	}
+	return int(a.GID - b.GID)
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/model"
+	"time"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), `CREATE TABLE IF NOT EXISTS incident (pod TEXT NOT NULL,namespace TEXT NOT NULL,container TEXT NOT NULL,
+		reason TEXT NOT NULL,message TEXT NOT NULL DEFAULT '',memory_limit BIGINT NOT NULL DEFAULT 0,count INT NOT NULL DEFAULT 1,
+		first_seen TIMESTAMP NOT NULL,last_seen TIMESTAMP NOT NULL)`)
+	addWorkloadColumns("incident")
+	// RecordIncident 依赖 (pod, namespace, container, reason, first_seen, session) 上的唯一约束
+	addSessionColumn("incident", "pod, namespace, container, reason, first_seen")
+	pool.Exec(context.Background(), "ALTER TABLE incident DROP CONSTRAINT IF EXISTS incident_pod_namespace_container_reason_first_seen_key")
+}
+
+// 记录的异常原因
+const (
+	IncidentOOMKilled        = "OOMKilled"
+	IncidentCrashLoopBackOff = "CrashLoopBackOff"
+	IncidentProbeFailure     = "ProbeFailure"
+	IncidentCPUThrottling    = "CPUThrottling"
+	IncidentFailedScheduling = "FailedScheduling"
+)
+
+// Incident 是一次容器终止或一条 Event 记录的异常。同一 Event 重复发生时 Count 增加，
+// OOMKilled 的 MemoryLimit 为当时容器的 memory limit，单位字节，没有 limit 时为 0
+type Incident struct {
+	Pod         string
+	Workload    model.Workload
+	Container   string // Pod 级别的异常（例如调度失败）为空
+	Reason      string
+	Message     string
+	MemoryLimit int64
+	Count       int
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// RecordIncident 写入一条异常，已记录过的同一异常更新其次数、最后发生时间和消息
+func RecordIncident(i Incident) error {
+	pool := dbPool()
+	query := `INSERT INTO incident (pod, namespace, container, reason, message, memory_limit, count, first_seen, last_seen, workload_kind, workload_name, session)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (pod, namespace, container, reason, first_seen, session) DO UPDATE
+		SET count = GREATEST(incident.count, EXCLUDED.count), last_seen = GREATEST(incident.last_seen, EXCLUDED.last_seen),
+			message = EXCLUDED.message, memory_limit = GREATEST(incident.memory_limit, EXCLUDED.memory_limit)`
+	_, err := pool.Exec(context.Background(), query, i.Pod, i.Workload.Namespace, i.Container, i.Reason, i.Message, i.MemoryLimit, max(i.Count, 1),
+		i.FirstSeen, i.LastSeen, i.Workload.Kind, i.Workload.Name, currentSession)
+	if err != nil {
+		return fmt.Errorf("RecordIncident failed: %w", err)
+	}
+	return nil
+}
+
+// IncidentSummary 是一个容器某种异常的汇总
+type IncidentSummary struct {
+	Container      string
+	Reason         string
+	Count          int64
+	LastSeen       time.Time
+	MaxMemoryLimit int64  // OOMKilled 时的最大 memory limit
+	Message        string // 最近一次的消息
+}
+
+// GetIncidentsByWorkload 按容器和原因汇总工作负载在 from 之后发生的异常
+func GetIncidentsByWorkload(workload model.Workload, from time.Time) (map[string][]IncidentSummary, error) {
+	pool := dbPool()
+	query := `SELECT container, reason, sum(count)::BIGINT, max(last_seen), max(memory_limit),
+			(array_agg(message ORDER BY last_seen DESC))[1]
+		FROM incident WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND last_seen >= $4 AND ` + sessionFilter(5) + `
+		GROUP BY container, reason ORDER BY container, reason`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, from, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetIncidentsByWorkload query failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := map[string][]IncidentSummary{}
+	for rows.Next() {
+		var s IncidentSummary
+		if err := rows.Scan(&s.Container, &s.Reason, &s.Count, &s.LastSeen, &s.MaxMemoryLimit, &s.Message); err != nil {
+			return nil, fmt.Errorf("GetIncidentsByWorkload scan failed: %w", err)
+		}
+		result[s.Container] = append(result[s.Container], s)
+	}
+	return result, rows.Err()
+}
+
+// GetOOMPeakMemoryByWorkload 返回工作负载在 from 之后没有 memory limit 时因 OOM 被终止的容器，
+// 在每次 OOM 前后 around 内观测到的最大内存使用，单位字节。没有指标的 OOM 不计入
+func GetOOMPeakMemoryByWorkload(workload model.Workload, from time.Time, around time.Duration) (map[string]int64, error) {
+	pool := dbPool()
+	bucket := time.Duration(conf.Metrics.RollupInterval) * time.Minute
+	query := `SELECT i.container, max(p.peak) FROM incident i, LATERAL (
+			SELECT max(memory_bytes) AS peak FROM metrics m
+			WHERE m.pod = i.pod AND m.namespace = i.namespace AND m.container = i.container AND m.session = i.session
+				AND m.timestamp BETWEEN i.first_seen - $6::INTERVAL AND i.last_seen + $6::INTERVAL
+			UNION ALL
+			SELECT max(memory_max) FROM metrics_rollup r
+			WHERE r.pod = i.pod AND r.namespace = i.namespace AND r.container = i.container AND r.session = i.session
+				AND r.bucket + $7::INTERVAL > i.first_seen - $6::INTERVAL AND r.bucket <= i.last_seen + $6::INTERVAL
+		) p
+		WHERE i.namespace = $1 AND i.workload_kind = $2 AND i.workload_name = $3 AND i.reason = $4 AND i.memory_limit = 0
+			AND i.last_seen >= $5 AND (cardinality($8::TEXT[]) = 0 OR i.session = ANY($8::TEXT[]))
+		GROUP BY i.container HAVING max(p.peak) IS NOT NULL`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, IncidentOOMKilled, from,
+		around, bucket, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetOOMPeakMemoryByWorkload query failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := map[string]int64{}
+	for rows.Next() {
+		var (
+			container string
+			peak      int64
+		)
+		if err := rows.Scan(&container, &peak); err != nil {
+			return nil, fmt.Errorf("GetOOMPeakMemoryByWorkload scan failed: %w", err)
+		}
+		result[container] = peak
+	}
+	return result, rows.Err()
+}
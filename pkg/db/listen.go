@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS listen (pod TEXT NOT NULL,namespace TEXT NOT NULL,container TEXT NOT NULL,ports TEXT[])")
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_listen_pod ON listen(pod)")
+	addWorkloadColumns("listen")
+	addSessionColumn("listen", "pod, namespace, container")
+	pool.Exec(context.Background(), "ALTER TABLE listen DROP CONSTRAINT IF EXISTS listen_pod_namespace_container_key")
+}
+
+// GetListeningPortsByWorkload 返回工作负载所有副本及历代 Pod 按容器汇总的监听端口，形如 8080/TCP
+func GetListeningPortsByWorkload(workload model.Workload) (map[string][]string, error) {
+	pool := dbPool()
+	query := `SELECT container, array_agg(DISTINCT p ORDER BY p) FROM listen, unnest(ports) AS p
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + ` GROUP BY container`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetListeningPortsByWorkload query failed: %w", err)
+	}
+	ports, err := collectByContainer(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetListeningPortsByWorkload scan failed: %w", err)
+	}
+	return ports, nil
+}
@@ -3,55 +3,278 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
+	"kubefix-cli/pkg/model"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 func init() {
 	pool := dbPool()
-	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS metrics (pod TEXT NOT NULL,namespace TEXT NOT NULL,cpu_usage TEXT NOT NULL,memory_usage TEXT NOT NULL,timestamp TIMESTAMP NOT NULL)")
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS metrics (pod TEXT NOT NULL,namespace TEXT NOT NULL,cpu_millicores BIGINT NOT NULL,memory_bytes BIGINT NOT NULL,timestamp TIMESTAMP NOT NULL)")
 	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_metrics_pod ON metrics(pod)")
 	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_metrics_timestamp ON metrics(timestamp)")
+	addWorkloadColumns("metrics")
+	addContainerColumn("metrics")
+	migrateMetricsText()
+	addSessionColumn("metrics", "")
+
+	pool.Exec(context.Background(), `CREATE TABLE IF NOT EXISTS metrics_rollup (
+		pod TEXT NOT NULL,namespace TEXT NOT NULL,container TEXT NOT NULL,workload_kind TEXT NOT NULL,workload_name TEXT NOT NULL,
+		bucket TIMESTAMP NOT NULL,samples BIGINT NOT NULL,
+		cpu_min BIGINT NOT NULL,cpu_max BIGINT NOT NULL,cpu_avg DOUBLE PRECISION NOT NULL,cpu_p50 BIGINT NOT NULL,cpu_p95 BIGINT NOT NULL,cpu_p99 BIGINT NOT NULL,
+		memory_min BIGINT NOT NULL,memory_max BIGINT NOT NULL,memory_avg DOUBLE PRECISION NOT NULL,memory_p50 BIGINT NOT NULL,memory_p95 BIGINT NOT NULL,memory_p99 BIGINT NOT NULL)`)
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_metrics_rollup_workload ON metrics_rollup(namespace, workload_kind, workload_name)")
+	// DownsampleMetrics 依赖 (pod, namespace, container, bucket, session) 上的唯一约束
+	addSessionColumn("metrics_rollup", "pod, namespace, container, bucket")
+	pool.Exec(context.Background(), "ALTER TABLE metrics_rollup DROP CONSTRAINT IF EXISTS metrics_rollup_pod_namespace_container_bucket_key")
+}
+
+// migrateMetricsText 将旧版本以 "120m"、"300MiB" 文本保存的指标转换为整数列
+func migrateMetricsText() {
+	pool := dbPool()
+	ctx := context.Background()
+	var exists bool
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'metrics' AND column_name = 'cpu_usage')`).Scan(&exists)
+	if err != nil || !exists {
+		return
+	}
+	err = WithTransaction(ctx, func(tx pgx.Tx) error {
+		stmts := []string{
+			"ALTER TABLE metrics ADD COLUMN IF NOT EXISTS cpu_millicores BIGINT, ADD COLUMN IF NOT EXISTS memory_bytes BIGINT",
+			`UPDATE metrics SET cpu_millicores = substring(cpu_usage FROM '^(\d+)m$')::BIGINT,
+				memory_bytes = substring(memory_usage FROM '^(\d+)MiB$')::BIGINT * 1048576`,
+			"DELETE FROM metrics WHERE cpu_millicores IS NULL OR memory_bytes IS NULL",
+			"ALTER TABLE metrics ALTER COLUMN cpu_millicores SET NOT NULL, ALTER COLUMN memory_bytes SET NOT NULL",
+			"ALTER TABLE metrics DROP COLUMN cpu_usage, DROP COLUMN memory_usage",
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Failed to migrate metrics table: %v\n", err)
+	}
 }
 
-func InsertMetrics(pod, namespace, cpu, memory string) error {
+// MetricSample 是一条容器指标记录，CPU 以毫核、内存以字节为单位
+type MetricSample struct {
+	Pod         string
+	Workload    model.Workload
+	Container   string
+	CPUMilli    int64
+	MemoryBytes int64
+	Timestamp   time.Time
+}
+
+func InsertMetrics(sample MetricSample) error {
 	pool := dbPool()
-	query := `INSERT INTO metrics (pod, namespace, cpu_usage, memory_usage, timestamp) VALUES ($1, $2, $3, $4, $5)`
-	_, err := pool.Exec(context.Background(), query, pod, namespace, cpu, memory, time.Now())
+	query := `INSERT INTO metrics (pod, namespace, container, cpu_millicores, memory_bytes, timestamp, workload_kind, workload_name, session) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	w := sample.Workload
+	_, err := pool.Exec(context.Background(), query, sample.Pod, w.Namespace, sample.Container, sample.CPUMilli, sample.MemoryBytes, sample.Timestamp, w.Kind, w.Name, currentSession)
 	if err != nil {
 		return fmt.Errorf("InsertMetric failed: %w", err)
 	}
 	return nil
 }
 
-// GetMetrics 查询指定 pod 和 namespace 的最近 limit 条指标记录
-func GetMetrics(pod, namespace string, limit int) string {
+// InsertMetricsBatch 批量写入指标记录，用于回填历史数据
+func InsertMetricsBatch(samples []MetricSample) error {
+	columns := []string{"pod", "namespace", "container", "cpu_millicores", "memory_bytes", "timestamp", "workload_kind", "workload_name", "session"}
+	_, err := dbPool().CopyFrom(context.Background(), pgx.Identifier{"metrics"}, columns, pgx.CopyFromSlice(len(samples), func(i int) ([]any, error) {
+		s := samples[i]
+		return []any{s.Pod, s.Workload.Namespace, s.Container, s.CPUMilli, s.MemoryBytes, s.Timestamp, s.Workload.Kind, s.Workload.Name, currentSession}, nil
+	}))
+	if err != nil {
+		return fmt.Errorf("InsertMetricsBatch failed: %w", err)
+	}
+	return nil
+}
+
+// GetMetrics 查询指定 pod 和 namespace 的最近 limit 条原始指标记录
+func GetMetrics(pod, namespace string, limit int) ([]MetricSample, error) {
 	pool := dbPool()
-	query := `SELECT pod, namespace, cpu_usage, memory_usage, timestamp FROM metrics WHERE pod = $1 AND namespace = $2 ORDER BY timestamp DESC LIMIT $3`
+	query := `SELECT pod, namespace, workload_kind, workload_name, container, cpu_millicores, memory_bytes, timestamp FROM metrics
+		WHERE pod = $1 AND namespace = $2 AND ` + sessionFilter(4) + ` ORDER BY timestamp DESC LIMIT $3`
+	rows, err := pool.Query(context.Background(), query, pod, namespace, limit, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetMetrics query failed: %w", err)
+	}
+	samples, err := collectSamples(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetMetrics scan failed: %w", err)
+	}
+	return samples, nil
+}
 
-	rows, err := pool.Query(context.Background(), query, pod, namespace, limit)
+// GetMetricsByWorkload 查询工作负载所有副本及历代 Pod 在 [from, to) 内的原始指标记录，按时间排序
+func GetMetricsByWorkload(workload model.Workload, from, to time.Time) ([]MetricSample, error) {
+	pool := dbPool()
+	query := `SELECT pod, namespace, workload_kind, workload_name, container, cpu_millicores, memory_bytes, timestamp FROM metrics
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND timestamp >= $4 AND timestamp < $5 AND ` + sessionFilter(6) + ` ORDER BY timestamp`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, from, to, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetMetricsByWorkload query failed: %w", err)
+	}
+	samples, err := collectSamples(rows)
 	if err != nil {
-		log.Fatalf("GetMetrics query failed: %v\n", err)
+		return nil, fmt.Errorf("GetMetricsByWorkload scan failed: %w", err)
 	}
+	return samples, nil
+}
+
+func collectSamples(rows pgx.Rows) ([]MetricSample, error) {
 	defer rows.Close()
+	var samples []MetricSample
+	for rows.Next() {
+		var s MetricSample
+		if err := rows.Scan(&s.Pod, &s.Workload.Namespace, &s.Workload.Kind, &s.Workload.Name, &s.Container, &s.CPUMilli, &s.MemoryBytes, &s.Timestamp); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// MetricStats 是一组指标值的统计结果
+type MetricStats struct {
+	Min         int64
+	Max         int64
+	Avg         int64
+	Percentiles map[int]int64 // 按百分位索引，只包含 AggregateMetrics 请求的百分位
+}
+
+// Percentile 返回第 p 百分位，p 必须是传给 AggregateMetrics 的百分位之一
+func (s MetricStats) Percentile(p int) int64 {
+	return s.Percentiles[p]
+}
 
-	var result string
-	type PodMetrics struct {
-		Pod         string    `json:"pod"`
-		Namespace   string    `json:"namespace"`
-		CPUUsage    string    `json:"cpu_usage"`
-		MemoryUsage string    `json:"memory_usage"`
-		Timestamp   time.Time `json:"timestamp"`
+// MetricAggregate 是一个容器在时间窗口内的指标汇总
+type MetricAggregate struct {
+	Container string
+	Samples   int64 // 原始样本数，包括已降采样的样本
+	Rollups   int64 // 参与汇总的降采样桶数
+	Pods      []string
+	From      time.Time
+	To        time.Time
+	CPU       MetricStats // 毫核
+	Memory    MetricStats // 字节
+}
+
+// rollupPercentile 返回降采样桶中不低于 p 的最近一个百分位列（50、95、99）
+func rollupPercentile(p int) string {
+	switch {
+	case p <= 50:
+		return "p50"
+	case p <= 95:
+		return "p95"
+	default:
+		return "p99"
 	}
+}
 
+// AggregateMetrics 在数据库中按容器汇总工作负载在 [from, to) 内的指标，同时包括原始样本和降采样桶，
+// 并计算 percentiles 中的每个百分位（1 到 100）。最小值、最大值和平均值是精确的；原始样本按样本值计算百分位，
+// 降采样桶以其不低于该百分位的最近一个百分位参与计算，因此包含降采样桶时百分位是近似值
+func AggregateMetrics(workload model.Workload, from, to time.Time, percentiles ...int) (map[string]MetricAggregate, error) {
+	var rawColumns, rollupColumns, aggregates []string
+	for i, p := range percentiles {
+		if p < 1 || p > 100 {
+			return nil, fmt.Errorf("AggregateMetrics: percentile %d out of range", p)
+		}
+		rawColumns = append(rawColumns, fmt.Sprintf("cpu_millicores AS cpu_q%[1]d, memory_bytes AS memory_q%[1]d", i))
+		rollupColumns = append(rollupColumns, fmt.Sprintf("cpu_%[1]s, memory_%[1]s", rollupPercentile(p)))
+		aggregates = append(aggregates, fmt.Sprintf("percentile_disc(%[2]g) WITHIN GROUP (ORDER BY cpu_q%[1]d), percentile_disc(%[2]g) WITHIN GROUP (ORDER BY memory_q%[1]d)",
+			i, float64(p)/100))
+	}
+	query := fmt.Sprintf(`WITH s AS (
+			SELECT pod, container, timestamp AS ts, 1::BIGINT AS n, 0 AS rollup,
+				cpu_millicores AS cpu_min, cpu_millicores AS cpu_max, cpu_millicores::DOUBLE PRECISION AS cpu_sum,
+				memory_bytes AS memory_min, memory_bytes AS memory_max, memory_bytes::DOUBLE PRECISION AS memory_sum%[2]s
+			FROM metrics WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND timestamp >= $4 AND timestamp < $5 AND %[1]s
+			UNION ALL
+			SELECT pod, container, bucket, samples, 1,
+				cpu_min, cpu_max, cpu_avg * samples, memory_min, memory_max, memory_avg * samples%[3]s
+			FROM metrics_rollup WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND bucket >= $4 AND bucket < $5 AND %[1]s
+		)
+		SELECT container, sum(n)::BIGINT, sum(rollup)::BIGINT, array_agg(DISTINCT pod ORDER BY pod), min(ts), max(ts),
+			min(cpu_min), max(cpu_max), round(sum(cpu_sum) / sum(n))::BIGINT,
+			min(memory_min), max(memory_max), round(sum(memory_sum) / sum(n))::BIGINT%[4]s
+		FROM s GROUP BY container`, sessionFilter(6), columnList(rawColumns), columnList(rollupColumns), columnList(aggregates))
+	pool := dbPool()
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, from, to, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("AggregateMetrics query failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := map[string]MetricAggregate{}
 	for rows.Next() {
-		var metric PodMetrics
-		err := rows.Scan(&metric.Pod, &metric.Namespace, &metric.CPUUsage, &metric.MemoryUsage, &metric.Timestamp)
-		if err != nil {
-			log.Fatalf("Error scanning row: %v\n", err)
+		a := MetricAggregate{CPU: MetricStats{Percentiles: map[int]int64{}}, Memory: MetricStats{Percentiles: map[int]int64{}}}
+		values := make([]int64, 2*len(percentiles))
+		dest := []any{&a.Container, &a.Samples, &a.Rollups, &a.Pods, &a.From, &a.To,
+			&a.CPU.Min, &a.CPU.Max, &a.CPU.Avg, &a.Memory.Min, &a.Memory.Max, &a.Memory.Avg}
+		for i := range values {
+			dest = append(dest, &values[i])
 		}
-		result += fmt.Sprintf("Timestamp: %s CPUUsage: %s MemoryUsage: %s\n", metric.Timestamp, metric.CPUUsage, metric.MemoryUsage)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("AggregateMetrics scan failed: %w", err)
+		}
+		for i, p := range percentiles {
+			a.CPU.Percentiles[p] = values[2*i]
+			a.Memory.Percentiles[p] = values[2*i+1]
+		}
+		result[a.Container] = a
 	}
+	return result, rows.Err()
+}
 
-	return result
+// columnList 将列拼接为追加在已有列之后的部分
+func columnList(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(columns, ", ")
+}
+
+// DownsampleMetrics 将 before 之前的原始样本按 bucket 聚合到 metrics_rollup 并删除原始样本，返回被降采样的样本数。
+// before 应与 bucket 对齐，避免同一个桶被拆分
+func DownsampleMetrics(before time.Time, bucket time.Duration) (int64, error) {
+	ctx := context.Background()
+	var downsampled int64
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		insert := `INSERT INTO metrics_rollup AS r (pod, namespace, container, workload_kind, workload_name, session, bucket, samples,
+				cpu_min, cpu_max, cpu_avg, cpu_p50, cpu_p95, cpu_p99,
+				memory_min, memory_max, memory_avg, memory_p50, memory_p95, memory_p99)
+			SELECT pod, namespace, container, workload_kind, workload_name, session,
+				TIMESTAMP '1970-01-01' + floor(extract(epoch FROM timestamp) / $2) * $2 * INTERVAL '1 second' AS b,
+				count(*), min(cpu_millicores), max(cpu_millicores), avg(cpu_millicores),
+				percentile_disc(0.5) WITHIN GROUP (ORDER BY cpu_millicores), percentile_disc(0.95) WITHIN GROUP (ORDER BY cpu_millicores), percentile_disc(0.99) WITHIN GROUP (ORDER BY cpu_millicores),
+				min(memory_bytes), max(memory_bytes), avg(memory_bytes),
+				percentile_disc(0.5) WITHIN GROUP (ORDER BY memory_bytes), percentile_disc(0.95) WITHIN GROUP (ORDER BY memory_bytes), percentile_disc(0.99) WITHIN GROUP (ORDER BY memory_bytes)
+			FROM metrics WHERE timestamp < $1
+			GROUP BY pod, namespace, container, workload_kind, workload_name, session, b
+			ON CONFLICT (pod, namespace, container, bucket, session) DO UPDATE SET
+				samples = r.samples + EXCLUDED.samples,
+				cpu_min = LEAST(r.cpu_min, EXCLUDED.cpu_min), cpu_max = GREATEST(r.cpu_max, EXCLUDED.cpu_max),
+				cpu_avg = (r.cpu_avg * r.samples + EXCLUDED.cpu_avg * EXCLUDED.samples) / (r.samples + EXCLUDED.samples),
+				cpu_p50 = GREATEST(r.cpu_p50, EXCLUDED.cpu_p50), cpu_p95 = GREATEST(r.cpu_p95, EXCLUDED.cpu_p95), cpu_p99 = GREATEST(r.cpu_p99, EXCLUDED.cpu_p99),
+				memory_min = LEAST(r.memory_min, EXCLUDED.memory_min), memory_max = GREATEST(r.memory_max, EXCLUDED.memory_max),
+				memory_avg = (r.memory_avg * r.samples + EXCLUDED.memory_avg * EXCLUDED.samples) / (r.samples + EXCLUDED.samples),
+				memory_p50 = GREATEST(r.memory_p50, EXCLUDED.memory_p50), memory_p95 = GREATEST(r.memory_p95, EXCLUDED.memory_p95), memory_p99 = GREATEST(r.memory_p99, EXCLUDED.memory_p99)`
+		if _, err := tx.Exec(ctx, insert, before, int64(bucket.Seconds())); err != nil {
+			return fmt.Errorf("DownsampleMetrics rollup failed: %w", err)
+		}
+		tag, err := tx.Exec(ctx, `DELETE FROM metrics WHERE timestamp < $1`, before)
+		if err != nil {
+			return fmt.Errorf("DownsampleMetrics delete failed: %w", err)
+		}
+		downsampled = tag.RowsAffected()
+		return nil
+	})
+	return downsampled, err
 }
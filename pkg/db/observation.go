@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ObservedPods 返回工作负载在 observe 期间留下过任何观测数据的 Pod
+func ObservedPods(workload model.Workload) ([]string, error) {
+	pool := dbPool()
+	query := fmt.Sprintf(`SELECT pod FROM metrics WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		UNION SELECT pod FROM capability WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		UNION SELECT pod FROM file WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		UNION SELECT pod FROM syscall WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		UNION SELECT pod FROM connection WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		UNION SELECT pod FROM process WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		UNION SELECT pod FROM identity WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		UNION SELECT pod FROM listen WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s
+		ORDER BY pod`, sessionFilter(4))
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("ObservedPods query failed: %w", err)
+	}
+	pods, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("ObservedPods scan failed: %w", err)
+	}
+	return pods, nil
+}
+
+// BehaviourObserved 报告 Falco 是否观测到过工作负载的行为：记录过 capability、写入文件、系统调用或进程，
+// 或覆盖情况中有行为观测样本。只有指标或连接数据的工作负载返回 false
+func BehaviourObserved(workload model.Workload) (bool, error) {
+	pool := dbPool()
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM capability WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s)
+		OR EXISTS (SELECT 1 FROM file WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s)
+		OR EXISTS (SELECT 1 FROM syscall WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s)
+		OR EXISTS (SELECT 1 FROM process WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s)
+		OR EXISTS (SELECT 1 FROM coverage WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND %[1]s AND samples > 0)`, sessionFilter(4))
+	var observed bool
+	err := pool.QueryRow(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions).Scan(&observed)
+	if err != nil {
+		return false, fmt.Errorf("BehaviourObserved query failed: %w", err)
+	}
+	return observed, nil
+}
+
+// ObservationSummary 是一个命名空间的观测数据统计
+type ObservationSummary struct {
+	Namespace     string
+	Pods          int64 // 留下过任何观测数据的 Pod 数
+	MetricSamples int64 // since 之后采集的指标样本数
+	Files         int64 // 记录的写入路径数
+	Capabilities  int64 // 记录的 capability 数
+	Syscalls      int64 // 记录的系统调用数
+	Connections   int64 // 记录的连接数
+	Processes     int64 // 记录的执行过的程序数
+}
+
+// SummarizeObservations 按命名空间统计所选会话的观测数据，指标样本只统计 since 之后的部分
+func SummarizeObservations(since time.Time) ([]ObservationSummary, error) {
+	pool := dbPool()
+	query := fmt.Sprintf(`WITH pods AS (
+			SELECT namespace, pod FROM metrics WHERE %[1]s UNION SELECT namespace, pod FROM capability WHERE %[1]s UNION SELECT namespace, pod FROM file WHERE %[1]s
+			UNION SELECT namespace, pod FROM syscall WHERE %[1]s UNION SELECT namespace, pod FROM connection WHERE %[1]s UNION SELECT namespace, pod FROM process WHERE %[1]s
+		), counts AS (
+			SELECT namespace, count(*) AS pods, 0 AS metrics, 0 AS files, 0 AS caps, 0 AS syscalls, 0 AS connections, 0 AS processes FROM pods GROUP BY namespace
+			UNION ALL SELECT namespace, 0, count(*), 0, 0, 0, 0, 0 FROM metrics WHERE timestamp >= $1 AND %[1]s GROUP BY namespace
+			UNION ALL SELECT namespace, 0, 0, sum(cardinality(files)), 0, 0, 0, 0 FROM file WHERE %[1]s GROUP BY namespace
+			UNION ALL SELECT namespace, 0, 0, 0, sum(cardinality(caps)), 0, 0, 0 FROM capability WHERE %[1]s GROUP BY namespace
+			UNION ALL SELECT namespace, 0, 0, 0, 0, sum(cardinality(syscalls)), 0, 0 FROM syscall WHERE %[1]s GROUP BY namespace
+			UNION ALL SELECT namespace, 0, 0, 0, 0, 0, count(*), 0 FROM connection WHERE %[1]s GROUP BY namespace
+			UNION ALL SELECT namespace, 0, 0, 0, 0, 0, 0, sum(cardinality(binaries)) FROM process WHERE %[1]s GROUP BY namespace
+		)
+		SELECT namespace, sum(pods)::BIGINT, sum(metrics)::BIGINT, coalesce(sum(files), 0)::BIGINT, coalesce(sum(caps), 0)::BIGINT,
+			coalesce(sum(syscalls), 0)::BIGINT, sum(connections)::BIGINT, coalesce(sum(processes), 0)::BIGINT
+		FROM counts GROUP BY namespace ORDER BY namespace`, sessionFilter(2))
+	rows, err := pool.Query(context.Background(), query, since, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("SummarizeObservations query failed: %w", err)
+	}
+	summaries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ObservationSummary, error) {
+		var s ObservationSummary
+		err := row.Scan(&s.Namespace, &s.Pods, &s.MetricSamples, &s.Files, &s.Capabilities, &s.Syscalls, &s.Connections, &s.Processes)
+		return s, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SummarizeObservations scan failed: %w", err)
+	}
+	return summaries, nil
+}
+
+// ObservedValue 是一条容器的文件、capability、系统调用或程序执行观测
+type ObservedValue struct {
+	Pod       string
+	Workload  model.Workload
+	Container string
+	Value     string
+}
+
+// ObservationBatch 是一批待写入的观测数据
+type ObservationBatch struct {
+	Files          []ObservedValue
+	Capabilities   []ObservedValue
+	Syscalls       []ObservedValue
+	SyscallCapture []ObservedValue // 启用了捕获所有系统调用的规则的容器，Value 为空
+	Processes      []ObservedValue
+	Users          []ObservedValue // 进程运行时的身份，uid:gid
+	Writers        []ObservedValue // 写入文件时的身份，uid:gid
+	Listening      []ObservedValue // 监听的端口，端口/协议
+	Connections    []Connection
+	Samples        map[model.Workload]int64 // 每个工作负载收到的观测条数，包括已去重的，用于统计覆盖情况
+}
+
+// Len 返回批次中的观测条数
+func (b ObservationBatch) Len() int {
+	return len(b.Files) + len(b.Capabilities) + len(b.Syscalls) + len(b.SyscallCapture) + len(b.Processes) + len(b.Users) + len(b.Writers) + len(b.Listening) + len(b.Connections)
+}
+
+// WriteObservations 在一次往返中写入一批观测数据。同一容器的多个值合并为一条原子的追加语句，
+// 并发写入同一行时不会丢失数据。写入后更新各工作负载的覆盖情况，追加了新的 capability、文件或系统调用的工作负载
+// 记为有新发现
+func WriteObservations(batch ObservationBatch) error {
+	b := &pgx.Batch{}
+	var novelty []model.Workload // 每条语句追加新值时视为有新发现的工作负载，不影响覆盖情况的语句为零值
+	novelty = append(novelty, queueAppends(b, "file", "files", batch.Files)...)
+	novelty = append(novelty, queueAppends(b, "capability", "caps", batch.Capabilities)...)
+	novelty = append(novelty, queueAppends(b, "syscall", "syscalls", batch.Syscalls)...)
+	for _, v := range batch.SyscallCapture {
+		b.Queue(markCompleteQuery, v.Pod, v.Workload.Namespace, v.Container, v.Workload.Kind, v.Workload.Name, currentSession)
+	}
+	queueAppends(b, "process", "binaries", batch.Processes)
+	queueAppends(b, "identity", "users", batch.Users)
+	queueAppends(b, "identity", "writers", batch.Writers)
+	queueAppends(b, "listen", "ports", batch.Listening)
+	for _, c := range batch.Connections {
+		b.Queue(insertConnectionQuery, c.insertArgs()...)
+	}
+	if b.Len() == 0 && len(batch.Samples) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	novel := map[model.Workload]bool{}
+	if b.Len() > 0 {
+		results := dbPool().SendBatch(ctx, b)
+		for i := range b.Len() {
+			tag, err := results.Exec()
+			if err != nil {
+				results.Close()
+				return fmt.Errorf("WriteObservations failed: %w", err)
+			}
+			if i < len(novelty) && tag.RowsAffected() > 0 {
+				novel[novelty[i]] = true
+			}
+		}
+		if err := results.Close(); err != nil {
+			return fmt.Errorf("WriteObservations failed: %w", err)
+		}
+	}
+
+	coverage := &pgx.Batch{}
+	queueCoverage(coverage, batch.Samples, novel, time.Now().UTC())
+	if coverage.Len() == 0 {
+		return nil
+	}
+	if err := dbPool().SendBatch(ctx, coverage).Close(); err != nil {
+		return fmt.Errorf("WriteObservations coverage failed: %w", err)
+	}
+	return nil
+}
+
+// queueAppends 按容器合并观测值，为每个容器加入一条追加语句，按加入顺序返回每条语句所属的工作负载
+func queueAppends(b *pgx.Batch, table, column string, values []ObservedValue) []model.Workload {
+	type key struct {
+		pod, namespace, container string
+	}
+	merged := map[key][]string{}
+	workloads := map[key]model.Workload{}
+	var order []key
+	for _, v := range values {
+		k := key{v.Pod, v.Workload.Namespace, v.Container}
+		if _, ok := merged[k]; !ok {
+			order = append(order, k)
+			workloads[k] = v.Workload
+		}
+		if !slices.Contains(merged[k], v.Value) {
+			merged[k] = append(merged[k], v.Value)
+		}
+	}
+	query := appendQuery(table, column)
+	queued := make([]model.Workload, 0, len(order))
+	for _, k := range order {
+		w := workloads[k]
+		b.Queue(query, k.pod, k.namespace, k.container, merged[k], w.Kind, w.Name, currentSession)
+		queued = append(queued, w)
+	}
+	return queued
+}
+
+// appendQuery 返回将 $4 中尚未记录的值追加到数组列的 upsert 语句，参数依次为
+// pod、namespace、container、values、workload_kind、workload_name、session
+func appendQuery(table, column string) string {
+	return fmt.Sprintf(`INSERT INTO %[1]s (pod, namespace, container, %[2]s, workload_kind, workload_name, session) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (pod, namespace, container, session) DO UPDATE
+		SET %[2]s = coalesce(%[1]s.%[2]s, '{}') || ARRAY(SELECT DISTINCT v FROM unnest(EXCLUDED.%[2]s) AS v WHERE v <> ALL(coalesce(%[1]s.%[2]s, '{}')))
+		WHERE NOT EXCLUDED.%[2]s <@ coalesce(%[1]s.%[2]s, '{}')`, table, column)
+}
+
+// collectByContainer 读取 (container, values) 形式的查询结果
+func collectByContainer(rows pgx.Rows) (map[string][]string, error) {
+	defer rows.Close()
+	result := map[string][]string{}
+	for rows.Next() {
+		var (
+			container string
+			values    []string
+		)
+		if err := rows.Scan(&container, &values); err != nil {
+			return nil, err
+		}
+		result[container] = values
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), `CREATE TABLE IF NOT EXISTS pressure (pod TEXT NOT NULL,namespace TEXT NOT NULL,container TEXT NOT NULL,
+		workload_kind TEXT NOT NULL,workload_name TEXT NOT NULL,throttling DOUBLE PRECISION NOT NULL,restarts BIGINT NOT NULL,timestamp TIMESTAMP NOT NULL)`)
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_pressure_workload ON pressure(namespace, workload_kind, workload_name)")
+	addSessionColumn("pressure", "")
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS metrics_backfill (namespace TEXT NOT NULL,until TIMESTAMP NOT NULL)")
+	// 每个会话分别记录回填进度
+	addSessionColumn("metrics_backfill", "namespace")
+	pool.Exec(context.Background(), "ALTER TABLE metrics_backfill DROP CONSTRAINT IF EXISTS metrics_backfill_pkey")
+}
+
+// PressureSample 是一条容器的 CPU 限流与重启记录
+type PressureSample struct {
+	Pod        string
+	Workload   model.Workload
+	Container  string
+	Throttling float64 // 被限流的 CFS 周期占比，0 到 1
+	Restarts   int64   // 容器累计重启次数
+	Timestamp  time.Time
+}
+
+// PressureSummary 是一个容器在时间窗口内的限流与重启汇总
+type PressureSummary struct {
+	Container     string
+	MaxThrottling float64
+	AvgThrottling float64
+	Restarts      int64 // 各 Pod 在时间窗口内的重启次数之和
+}
+
+// InsertPressure 批量写入限流与重启记录
+func InsertPressure(samples []PressureSample) error {
+	columns := []string{"pod", "namespace", "container", "workload_kind", "workload_name", "throttling", "restarts", "timestamp", "session"}
+	_, err := dbPool().CopyFrom(context.Background(), pgx.Identifier{"pressure"}, columns, pgx.CopyFromSlice(len(samples), func(i int) ([]any, error) {
+		s := samples[i]
+		return []any{s.Pod, s.Workload.Namespace, s.Container, s.Workload.Kind, s.Workload.Name, s.Throttling, s.Restarts, s.Timestamp, currentSession}, nil
+	}))
+	if err != nil {
+		return fmt.Errorf("InsertPressure failed: %w", err)
+	}
+	return nil
+}
+
+// GetPressureByWorkload 按容器汇总工作负载在 [from, to) 内的限流与重启情况。
+// restarts 是累计计数，窗口内的重启次数为每个 Pod 在每个会话中的最大值与最小值之差
+func GetPressureByWorkload(workload model.Workload, from, to time.Time) (map[string]PressureSummary, error) {
+	pool := dbPool()
+	query := `SELECT container, max(max_throttling), sum(sum_throttling) / sum(n), sum(restarts)::BIGINT FROM (
+			SELECT container, pod, max(throttling) AS max_throttling, sum(throttling) AS sum_throttling, count(*) AS n, max(restarts) - min(restarts) AS restarts
+			FROM pressure WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND timestamp >= $4 AND timestamp < $5 AND ` + sessionFilter(6) + `
+			GROUP BY container, pod, session
+		) p GROUP BY container`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, from, to, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetPressureByWorkload query failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := map[string]PressureSummary{}
+	for rows.Next() {
+		var s PressureSummary
+		if err := rows.Scan(&s.Container, &s.MaxThrottling, &s.AvgThrottling, &s.Restarts); err != nil {
+			return nil, fmt.Errorf("GetPressureByWorkload scan failed: %w", err)
+		}
+		result[s.Container] = s
+	}
+	return result, rows.Err()
+}
+
+// BackfilledUntil 返回命名空间在当前会话中已回填到的时间，从未回填时返回零值
+func BackfilledUntil(namespace string) (time.Time, error) {
+	pool := dbPool()
+	var until time.Time
+	err := pool.QueryRow(context.Background(), `SELECT until FROM metrics_backfill WHERE namespace = $1 AND session = $2`, namespace, currentSession).Scan(&until)
+	if err == pgx.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("BackfilledUntil failed: %w", err)
+	}
+	return until, nil
+}
+
+// SetBackfilledUntil 记录命名空间已回填到的时间，避免重复回填同一时段
+func SetBackfilledUntil(namespace string, until time.Time) error {
+	pool := dbPool()
+	query := `INSERT INTO metrics_backfill (namespace, until, session) VALUES ($1, $2, $3)
+		ON CONFLICT (namespace, session) DO UPDATE SET until = GREATEST(metrics_backfill.until, EXCLUDED.until)`
+	if _, err := pool.Exec(context.Background(), query, namespace, until, currentSession); err != nil {
+		return fmt.Errorf("SetBackfilledUntil failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS process (pod TEXT NOT NULL,namespace TEXT NOT NULL,container TEXT NOT NULL,binaries TEXT[])")
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_process_pod ON process(pod)")
+	addWorkloadColumns("process")
+	// WriteObservations 依赖 (pod, namespace, container, session) 上的唯一约束
+	addSessionColumn("process", "pod, namespace, container")
+	pool.Exec(context.Background(), "ALTER TABLE process DROP CONSTRAINT IF EXISTS process_pod_namespace_container_key")
+}
+
+// GetProcessesByWorkload 返回工作负载所有副本及历代 Pod 按容器汇总的执行过的程序
+func GetProcessesByWorkload(workload model.Workload) (map[string][]string, error) {
+	pool := dbPool()
+	query := `SELECT container, array_agg(DISTINCT b ORDER BY b) FROM process, unnest(binaries) AS b
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + ` GROUP BY container`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetProcessesByWorkload query failed: %w", err)
+	}
+	processes, err := collectByContainer(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetProcessesByWorkload scan failed: %w", err)
+	}
+	return processes, nil
+}
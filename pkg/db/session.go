@@ -0,0 +1,258 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func init() {
+	createSessionTable()
+}
+
+// createSessionTable 创建会话表。各观测表的 init 在迁移旧数据时也会调用它，不依赖各文件 init 的执行顺序
+func createSessionTable() {
+	pool := dbPool()
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS session (id TEXT PRIMARY KEY,cluster TEXT NOT NULL DEFAULT '',started TIMESTAMP NOT NULL,ended TIMESTAMP)")
+}
+
+// LegacySession 是引入会话之前写入的观测数据迁移到的会话
+const LegacySession = "legacy"
+
+// sessionTables 是带有会话列的观测表
+var sessionTables = []string{"metrics", "metrics_rollup", "pressure", "metrics_backfill", "capability", "file", "syscall",
+	"process", "identity", "listen", "connection", "incident", "coverage"}
+
+var (
+	// currentSession 是写入的观测数据所属的会话，未开始会话时为空字符串
+	currentSession string
+	// selectedSessions 是读取观测数据时限定的会话，为空时读取所有会话
+	selectedSessions = []string{}
+)
+
+// Session 是一次 observe、replay 或 backfill 运行，Ended 为零值表示尚未结束
+type Session struct {
+	ID      string
+	Cluster string
+	Started time.Time
+	Ended   time.Time
+}
+
+// addSessionColumn 为观测表添加会话列，并将没有会话的旧数据迁移到 LegacySession。key 非空时在其后加上会话列建立唯一索引，
+// 取代原来在 key 上的唯一约束
+func addSessionColumn(table, key string) {
+	pool := dbPool()
+	pool.Exec(context.Background(), "ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS session TEXT NOT NULL DEFAULT ''")
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_"+table+"_session ON "+table+"(session)")
+	if key != "" {
+		pool.Exec(context.Background(), "CREATE UNIQUE INDEX IF NOT EXISTS idx_"+table+"_session_key ON "+table+"("+key+", session)")
+	}
+	migrateLegacySession(table)
+}
+
+// migrateLegacySession 将表中会话为空字符串的旧数据移到 LegacySession，使其能被 session list 列出和 session delete 删除
+func migrateLegacySession(table string) {
+	ctx := context.Background()
+	pool := dbPool()
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE session = '')").Scan(&exists); err != nil || !exists {
+		return
+	}
+	createSessionTable()
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		now := time.Now().UTC()
+		if _, err := tx.Exec(ctx, `INSERT INTO session (id, started, ended) VALUES ($1, $2, $2) ON CONFLICT (id) DO NOTHING`, LegacySession, now); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "UPDATE "+table+" SET session = $1 WHERE session = ''", LegacySession)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("Failed to move observations without a session in table %s to session '%s': %v\n", table, LegacySession, err)
+	}
+}
+
+// sessionFilter 返回以第 n 个参数限定会话的条件，参数为空数组时不限定
+func sessionFilter(n int) string {
+	return fmt.Sprintf("(cardinality($%[1]d::TEXT[]) = 0 OR session = ANY($%[1]d::TEXT[]))", n)
+}
+
+// StartSession 开始或继续一个会话，之后写入的观测数据都属于这个会话
+func StartSession(id, cluster string) error {
+	pool := dbPool()
+	query := `INSERT INTO session (id, cluster, started) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET ended = NULL, cluster = CASE WHEN EXCLUDED.cluster = '' THEN session.cluster ELSE EXCLUDED.cluster END`
+	if _, err := pool.Exec(context.Background(), query, id, cluster, time.Now().UTC()); err != nil {
+		return fmt.Errorf("StartSession failed: %w", err)
+	}
+	currentSession = id
+	return nil
+}
+
+// EndSession 记录当前会话的结束时间
+func EndSession() error {
+	if currentSession == "" {
+		return nil
+	}
+	pool := dbPool()
+	if _, err := pool.Exec(context.Background(), `UPDATE session SET ended = $2 WHERE id = $1`, currentSession, time.Now().UTC()); err != nil {
+		return fmt.Errorf("EndSession failed: %w", err)
+	}
+	return nil
+}
+
+// SelectSessions 限定之后读取的观测数据为这些会话的并集，为空时读取所有会话
+func SelectSessions(ids []string) {
+	selectedSessions = append([]string{}, ids...)
+}
+
+// GetSession 返回会话，不存在时 ok 为 false
+func GetSession(id string) (s Session, ok bool, err error) {
+	pool := dbPool()
+	var ended *time.Time
+	err = pool.QueryRow(context.Background(), `SELECT id, cluster, started, ended FROM session WHERE id = $1`, id).Scan(&s.ID, &s.Cluster, &s.Started, &ended)
+	if err == pgx.ErrNoRows {
+		return s, false, nil
+	}
+	if err != nil {
+		return s, false, fmt.Errorf("GetSession failed: %w", err)
+	}
+	if ended != nil {
+		s.Ended = *ended
+	}
+	return s, true, nil
+}
+
+// SessionSummary 是一个会话的观测数据统计
+type SessionSummary struct {
+	Session
+	Workloads     int64 // 留下过任何观测数据的工作负载数
+	MetricSamples int64 // 原始指标样本数，不包括已降采样的样本
+	Files         int64
+	Capabilities  int64
+	Incidents     int64
+}
+
+// ListSessions 按开始时间返回所有会话及其观测数据统计
+func ListSessions() ([]SessionSummary, error) {
+	pool := dbPool()
+	query := `SELECT s.id, s.cluster, s.started, s.ended,
+			(SELECT count(*) FROM (
+				SELECT namespace, workload_kind, workload_name FROM metrics WHERE session = s.id
+				UNION SELECT namespace, workload_kind, workload_name FROM metrics_rollup WHERE session = s.id
+				UNION SELECT namespace, workload_kind, workload_name FROM capability WHERE session = s.id
+				UNION SELECT namespace, workload_kind, workload_name FROM file WHERE session = s.id
+				UNION SELECT namespace, workload_kind, workload_name FROM syscall WHERE session = s.id
+				UNION SELECT namespace, workload_kind, workload_name FROM process WHERE session = s.id
+				UNION SELECT namespace, workload_kind, workload_name FROM connection WHERE session = s.id
+			) w),
+			(SELECT count(*) FROM metrics WHERE session = s.id),
+			(SELECT coalesce(sum(cardinality(files)), 0) FROM file WHERE session = s.id)::BIGINT,
+			(SELECT coalesce(sum(cardinality(caps)), 0) FROM capability WHERE session = s.id)::BIGINT,
+			(SELECT count(*) FROM incident WHERE session = s.id)
+		FROM session s ORDER BY s.started, s.id`
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions query failed: %w", err)
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SessionSummary, error) {
+		var (
+			s     SessionSummary
+			ended *time.Time
+		)
+		err := row.Scan(&s.ID, &s.Cluster, &s.Started, &ended, &s.Workloads, &s.MetricSamples, &s.Files, &s.Capabilities, &s.Incidents)
+		if ended != nil {
+			s.Ended = *ended
+		}
+		return s, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ListSessions scan failed: %w", err)
+	}
+	return sessions, nil
+}
+
+// DeleteSession 在一个事务中删除会话及其所有观测数据，返回删除的观测记录数
+func DeleteSession(id string) (int64, error) {
+	ctx := context.Background()
+	var deleted int64
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		for _, table := range sessionTables {
+			tag, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE session = $1", id)
+			if err != nil {
+				return fmt.Errorf("DeleteSession %s failed: %w", table, err)
+			}
+			deleted += tag.RowsAffected()
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM session WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("DeleteSession failed: %w", err)
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// SessionDiff 是一个容器在新会话中观测到、而在旧会话中没有观测到的 capability 和写入文件
+type SessionDiff struct {
+	Workload     model.Workload
+	Container    string
+	Capabilities []string
+	Files        []string
+}
+
+// DiffSessions 按工作负载和容器比较两个会话，返回 newer 中新观测到的 capability 和写入文件。
+// 同一工作负载的不同 Pod 合并比较，只在 newer 中出现的工作负载的所有观测都视为新观测
+func DiffSessions(older, newer string) ([]SessionDiff, error) {
+	pool := dbPool()
+	diffs := map[[4]string]*SessionDiff{}
+	var order [][4]string
+	for _, column := range [][2]string{{"capability", "caps"}, {"file", "files"}} {
+		query := fmt.Sprintf(`SELECT namespace, workload_kind, workload_name, container, array_agg(DISTINCT v ORDER BY v)
+			FROM %[1]s n, unnest(n.%[2]s) AS v
+			WHERE n.session = $2 AND NOT EXISTS (
+				SELECT 1 FROM %[1]s o WHERE o.session = $1 AND o.namespace = n.namespace AND o.workload_kind = n.workload_kind
+					AND o.workload_name = n.workload_name AND o.container = n.container AND v = ANY(o.%[2]s))
+			GROUP BY namespace, workload_kind, workload_name, container
+			ORDER BY namespace, workload_kind, workload_name, container`, column[0], column[1])
+		rows, err := pool.Query(context.Background(), query, older, newer)
+		if err != nil {
+			return nil, fmt.Errorf("DiffSessions query failed: %w", err)
+		}
+		for rows.Next() {
+			var (
+				k      [4]string
+				values []string
+			)
+			if err := rows.Scan(&k[0], &k[1], &k[2], &k[3], &values); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("DiffSessions scan failed: %w", err)
+			}
+			d, ok := diffs[k]
+			if !ok {
+				d = &SessionDiff{Workload: model.Workload{Namespace: k[0], Kind: k[1], Name: k[2]}, Container: k[3]}
+				diffs[k] = d
+				order = append(order, k)
+			}
+			if column[0] == "capability" {
+				d.Capabilities = values
+			} else {
+				d.Files = values
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("DiffSessions scan failed: %w", err)
+		}
+	}
+
+	slices.SortFunc(order, func(a, b [4]string) int { return slices.Compare(a[:], b[:]) })
+	result := make([]SessionDiff, 0, len(order))
+	for _, k := range order {
+		result = append(result, *diffs[k])
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/model"
+)
+
+func init() {
+	pool := dbPool()
+	pool.Exec(context.Background(), "CREATE TABLE IF NOT EXISTS syscall (pod TEXT NOT NULL,namespace TEXT NOT NULL,container TEXT NOT NULL,syscalls TEXT[])")
+	pool.Exec(context.Background(), "CREATE INDEX IF NOT EXISTS idx_syscall_pod ON syscall(pod)")
+	addWorkloadColumns("syscall")
+	// WriteObservations 依赖 (pod, namespace, container, session) 上的唯一约束
+	addSessionColumn("syscall", "pod, namespace, container")
+	pool.Exec(context.Background(), "ALTER TABLE syscall DROP CONSTRAINT IF EXISTS syscall_pod_namespace_container_key")
+	// complete 表示记录期间启用了捕获所有系统调用的规则，否则只记录了部分规则涉及的系统调用
+	pool.Exec(context.Background(), "ALTER TABLE syscall ADD COLUMN IF NOT EXISTS complete BOOLEAN NOT NULL DEFAULT false")
+}
+
+// markCompleteQuery 将容器的系统调用记录标记为完整捕获，参数与 appendQuery 相同，不含 values
+const markCompleteQuery = `INSERT INTO syscall (pod, namespace, container, syscalls, workload_kind, workload_name, session, complete)
+	VALUES ($1, $2, $3, '{}', $4, $5, $6, true)
+	ON CONFLICT (pod, namespace, container, session) DO UPDATE SET complete = true WHERE NOT syscall.complete`
+
+// GetSyscallsByWorkload 返回工作负载所有副本及历代 Pod 按容器汇总的系统调用
+func GetSyscallsByWorkload(workload model.Workload) (map[string][]string, error) {
+	pool := dbPool()
+	query := `SELECT container, array_agg(DISTINCT s ORDER BY s) FROM syscall, unnest(syscalls) AS s
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + ` GROUP BY container`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetSyscallsByWorkload query failed: %w", err)
+	}
+	syscalls, err := collectByContainer(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetSyscallsByWorkload scan failed: %w", err)
+	}
+	return syscalls, nil
+}
+
+// GetSyscallCaptureByWorkload 返回工作负载的各个容器是否有完整捕获了所有系统调用的记录，
+// 没有完整捕获时记录的系统调用只包括部分规则涉及的系统调用，不能作为白名单
+func GetSyscallCaptureByWorkload(workload model.Workload) (map[string]bool, error) {
+	pool := dbPool()
+	query := `SELECT container, bool_or(complete) FROM syscall
+		WHERE namespace = $1 AND workload_kind = $2 AND workload_name = $3 AND ` + sessionFilter(4) + ` GROUP BY container`
+	rows, err := pool.Query(context.Background(), query, workload.Namespace, workload.Kind, workload.Name, selectedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("GetSyscallCaptureByWorkload query failed: %w", err)
+	}
+	defer rows.Close()
+	result := map[string]bool{}
+	for rows.Next() {
+		var (
+			container string
+			complete  bool
+		)
+		if err := rows.Scan(&container, &complete); err != nil {
+			return nil, fmt.Errorf("GetSyscallCaptureByWorkload scan failed: %w", err)
+		}
+		result[container] = complete
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,134 @@
+package falco
+
+import (
+	"bytes"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Baseline 是一个工作负载在 observe 期间学到的运行时行为
+type Baseline struct {
+	Workload   model.Workload
+	PodLabels  map[string]string // Pod 模板的标签，用于在 Falco 中匹配该工作负载的 Pod
+	Containers []ContainerBaseline
+}
+
+// ContainerBaseline 是一个容器观测到的程序、写入的文件和 capabilities（带 CAP_ 前缀）
+type ContainerBaseline struct {
+	Name         string
+	Processes    []string
+	Files        []string
+	Capabilities []string
+}
+
+// DeviationRules 为每个工作负载的容器生成 Falco 规则，在其执行未观测到的程序、在观测到的路径之外写入文件
+// 或使用未观测到的 capability 时告警。没有观测到任何程序的容器不生成执行规则
+func DeviationRules(baselines []Baseline, priority string) ([]byte, error) {
+	exec, _ := lookupRule("kubefix process exec")
+	write, _ := lookupRule("kubefix file write")
+
+	var entries []rulesEntry
+	for _, b := range baselines {
+		id := fmt.Sprintf("%s/%s/%s", b.Workload.Namespace, strings.ToLower(b.Workload.Kind), b.Workload.Name)
+		for _, c := range b.Containers {
+			scope := podScope(b) + " and container.name = " + strconv.Quote(c.Name)
+			tags := []string{"kubefix", "deviation", b.Workload.Namespace}
+			add := func(what, desc, condition, output string) {
+				entries = append(entries, rulesEntry{
+					Rule:      fmt.Sprintf("kubefix deviation %s %s %s", id, c.Name, what),
+					Desc:      desc,
+					Condition: scope + " and " + condition,
+					Output:    fmt.Sprintf("%s in %s container %s (%s)", output, id, c.Name, fieldsOutput),
+					Priority:  priority,
+					Tags:      tags,
+				})
+			}
+
+			if len(c.Processes) > 0 {
+				add("exec", "Executed a program not seen while observing the workload",
+					exec.Condition+" and not proc.exepath in ("+quoteList(c.Processes)+")",
+					"Unobserved program executed")
+			}
+
+			condition := write.Condition
+			if dirs := writeDirs(c.Files); len(dirs) > 0 {
+				condition += " and not fd.name pmatch (" + quoteList(dirs) + ")"
+			}
+			add("write", "Wrote a file outside the paths seen while observing the workload",
+				condition, "File written outside observed paths (file=%fd.name)")
+
+			var unobserved []string
+			for _, r := range Rules {
+				if r.Kind == kindCapability && !slices.Contains(c.Capabilities, r.Capability) {
+					unobserved = append(unobserved, "("+r.Condition+")")
+				}
+			}
+			if len(unobserved) > 0 {
+				add("capability", "Made a syscall requiring a capability not seen while observing the workload",
+					"("+strings.Join(unobserved, " or ")+")", "Unobserved capability used")
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by kubefix-cli falco-deviation. Rules alert when a workload deviates from its observed baseline.\n")
+	if len(entries) == 0 {
+		return buf.Bytes(), nil
+	}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(entries); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// podScope 返回匹配工作负载的 Pod 的条件。没有标签的裸 Pod 按名称匹配
+func podScope(b Baseline) string {
+	conditions := []string{"k8s.ns.name = " + strconv.Quote(b.Workload.Namespace)}
+	if len(b.PodLabels) == 0 {
+		conditions = append(conditions, "k8s.pod.name = "+strconv.Quote(b.Workload.Name))
+	}
+	for _, k := range slices.Sorted(maps.Keys(b.PodLabels)) {
+		conditions = append(conditions, fmt.Sprintf("k8s.pod.label[%s] = %s", k, strconv.Quote(b.PodLabels[k])))
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// writeDirs 返回写入过的文件所在的目录，已被其他目录包含的目录会被去掉
+func writeDirs(files []string) []string {
+	var dirs []string
+	for _, f := range files {
+		dir := path.Dir(path.Clean(f))
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	slices.Sort(dirs)
+	var result []string
+	for _, d := range dirs {
+		if len(result) > 0 {
+			last := result[len(result)-1]
+			if last == "/" || strings.HasPrefix(d, last+"/") {
+				continue
+			}
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return strings.Join(quoted, ", ")
+}
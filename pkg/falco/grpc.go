@@ -0,0 +1,214 @@
+package falco
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"kubefix-cli/conf"
+	"log"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// subMethod 是 Falco outputs 服务的订阅方法，客户端每发送一个空请求，服务端返回此后产生的告警
+const subMethod = "/falco.outputs.service/sub"
+
+// pollInterval 是向 Falco 请求新告警的间隔
+const pollInterval = time.Second
+
+// subscribeGRPC 订阅 Falco 的 gRPC outputs 服务，直到 ctx 结束
+func subscribeGRPC(ctx context.Context, cfg conf.FalcoGRPCConfig, p *pipeline) error {
+	creds, err := grpcCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.NewClient(cfg.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("connect to falco grpc %s: %w", cfg.Address, err)
+	}
+	defer conn.Close()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	desc := &grpc.StreamDesc{StreamName: "sub", ServerStreams: true, ClientStreams: true}
+	stream, err := conn.NewStream(streamCtx, desc, subMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return fmt.Errorf("subscribe to falco outputs: %w", err)
+	}
+	log.Printf("Subscribed to Falco outputs at %s", cfg.Address)
+
+	sendErr := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			request := []byte{}
+			if err := stream.SendMsg(&request); err != nil {
+				sendErr <- err
+				return
+			}
+			select {
+			case <-streamCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	for {
+		var msg []byte
+		if err := stream.RecvMsg(&msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			select {
+			case sendErr := <-sendErr:
+				return fmt.Errorf("request falco outputs: %w", sendErr)
+			default:
+			}
+			return fmt.Errorf("receive falco outputs: %w", err)
+		}
+		alert, err := decodeOutput(msg)
+		if err != nil {
+			p.malformed.Add(1)
+			continue
+		}
+		p.submit(observations(alert), -1)
+	}
+}
+
+func grpcCredentials(cfg conf.FalcoGRPCConfig) (credentials.TransportCredentials, error) {
+	if cfg.CACert == "" {
+		if cfg.ClientCert != "" {
+			return nil, errors.New("falco grpc clientCert requires caCert")
+		}
+		return insecure.NewCredentials(), nil
+	}
+	pem, err := os.ReadFile(cfg.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("read falco grpc ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.CACert)
+	}
+	config := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load falco grpc client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// rawCodec 直接收发 protobuf 编码后的字节，避免依赖 Falco 的生成代码
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// Falco outputs.proto 中 response 消息的字段编号
+const (
+	responseRule         = 4
+	responseOutputFields = 6
+)
+
+// decodeOutput 解码 falco.outputs.response 消息中的 rule 和 output_fields
+func decodeOutput(b []byte) (Alert, error) {
+	var rule string
+	fields := map[string]any{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return Alert{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == responseRule && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return Alert{}, protowire.ParseError(n)
+			}
+			rule = v
+			b = b[n:]
+		case num == responseOutputFields && typ == protowire.BytesType:
+			entry, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return Alert{}, protowire.ParseError(n)
+			}
+			key, value, err := decodeMapEntry(entry)
+			if err != nil {
+				return Alert{}, err
+			}
+			fields[key] = value
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return Alert{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	if rule == "" {
+		return Alert{}, errors.New("missing rule")
+	}
+	return NormalizeAlert(rule, fields), nil
+}
+
+// decodeMapEntry 解码 map<string, string> 的一个条目
+func decodeMapEntry(b []byte) (key, value string, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		b = b[n:]
+		if (num == 1 || num == 2) && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return "", "", protowire.ParseError(n)
+			}
+			if num == 1 {
+				key = v
+			} else {
+				value = v
+			}
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return key, value, nil
+}
@@ -0,0 +1,141 @@
+package falco
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/utils"
+	"log"
+	"sync"
+)
+
+// maxLineBytes 是日志中单行告警的最大长度
+const maxLineBytes = 1 << 20
+
+// StartFalcoIngestion 启动告警处理管道和配置的各个输入（Falco 的 HTTP、文件和 gRPC 以及 Tetragon 的 JSON 导出），直到 ctx 结束。
+// 各输入失败时单独重启；结束时先停止所有输入，再写完队列中剩余的观测
+func StartFalcoIngestion(ctx context.Context) error {
+	cfg := conf.Falco
+	inputs := map[string]func(context.Context, *pipeline) error{}
+	if cfg.Listen != "off" {
+		inputs["Falco HTTP input"] = func(ctx context.Context, p *pipeline) error { return serveHTTP(ctx, cfg, p) }
+	}
+	if cfg.TailFile != "" {
+		inputs["Falco file input"] = func(ctx context.Context, p *pipeline) error { return tailFile(ctx, cfg.TailFile, cfg.TailFromStart, p) }
+	}
+	if conf.Tetragon.ExportFile != "" {
+		inputs["Tetragon export input"] = func(ctx context.Context, p *pipeline) error {
+			return tailFile(ctx, conf.Tetragon.ExportFile, conf.Tetragon.FromStart, p)
+		}
+	}
+	if cfg.GRPC.Address != "" {
+		inputs["Falco gRPC input"] = func(ctx context.Context, p *pipeline) error { return subscribeGRPC(ctx, cfg.GRPC, p) }
+	}
+	if len(inputs) == 0 {
+		return errors.New("no falco or tetragon input configured")
+	}
+
+	withPipeline(cfg, func(p *pipeline) {
+		var wg sync.WaitGroup
+		for name, input := range inputs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				utils.Supervise(ctx, name, func(ctx context.Context) error { return input(ctx, p) })
+			}()
+		}
+		wg.Wait()
+	})
+	return nil
+}
+
+// Replay 将保存的告警日志（每行一个 Falco JSON 告警或 Tetragon 事件）送入告警处理管道并写入数据库，
+// 队列已满时等待而不丢弃，返回处理完成后的计数
+func Replay(ctx context.Context, r io.Reader) (Stats, error) {
+	var err error
+	withPipeline(conf.Falco, func(p *pipeline) {
+		err = readAlerts(ctx, r, p)
+	})
+	stats, _ := PipelineStats()
+	return stats, err
+}
+
+// withPipeline 创建告警处理管道并启动写入协程，feed 返回后写完队列中剩余的观测
+func withPipeline(cfg conf.FalcoConfig, feed func(p *pipeline)) {
+	var err error
+	owners, err = client.NewOwnerResolver()
+	if err != nil {
+		log.Printf("Owner resolution disabled, observations will be keyed by pod: %v", err)
+	}
+
+	peers, err = client.NewPeerResolver()
+	if err != nil {
+		log.Printf("Peer resolution disabled, connection peers will be recorded as IP addresses: %v", err)
+	}
+
+	p := newPipeline(cfg, resolveWorkload, resolvePeer)
+	stopWriter := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		p.run(stopWriter)
+		close(writerDone)
+	}()
+
+	feed(p)
+	// 所有输入都已停止，不再有新的观测，此时通知写入协程写完队列中剩余的观测
+	close(stopWriter)
+	<-writerDone
+	stats := p.stats()
+	lastStats.Store(stats)
+	log.Printf("Falco alert pipeline drained: %s", stats)
+}
+
+// readAlerts 逐行读取告警并送入管道，直到读完或 ctx 结束。无法解析的行被计数后跳过
+func readAlerts(ctx context.Context, r io.Reader, p *pipeline) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		submitLine(scanner.Bytes(), p)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read alerts: %w", err)
+	}
+	return nil
+}
+
+// submitLine 解析一行日志中的 Falco 告警或 Tetragon 事件并等待送入队列，空行被忽略
+func submitLine(line []byte, p *pipeline) {
+	if len(line) == 0 {
+		return
+	}
+	if i := bytes.IndexByte(line, '{'); i > 0 && line[0] != '[' {
+		// 去掉日志前缀
+		line = line[i:]
+	}
+	if isTetragonEvent(line) {
+		var event tetragonEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			p.malformed.Add(1)
+			return
+		}
+		p.submit(tetragonObservations(event), -1)
+		return
+	}
+	alerts, err := ParseAlerts(line)
+	if err != nil {
+		p.malformed.Add(1)
+		return
+	}
+	for _, alert := range alerts {
+		p.submit(observations(alert), -1)
+	}
+}
@@ -0,0 +1,111 @@
+package falco
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kubefix-cli/conf"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// authenticator 校验告警请求的 Bearer Token 和请求体的 HMAC 签名，未配置的校验会被跳过
+type authenticator struct {
+	token      string
+	hmacSecret []byte
+	hmacHeader string
+}
+
+func newAuthenticator(cfg conf.FalcoConfig) (*authenticator, error) {
+	a := &authenticator{hmacHeader: cfg.HMACHeader}
+	if cfg.TokenEnv != "" {
+		a.token = os.Getenv(cfg.TokenEnv)
+		if a.token == "" {
+			return nil, fmt.Errorf("environment variable %s for the falco token is empty", cfg.TokenEnv)
+		}
+	}
+	if cfg.HMACSecretEnv != "" {
+		a.hmacSecret = []byte(os.Getenv(cfg.HMACSecretEnv))
+		if len(a.hmacSecret) == 0 {
+			return nil, fmt.Errorf("environment variable %s for the falco hmac secret is empty", cfg.HMACSecretEnv)
+		}
+	}
+	return a, nil
+}
+
+func (a *authenticator) enabled() bool {
+	return a.token != "" || len(a.hmacSecret) > 0
+}
+
+// verify 校验请求头，body 为已读取的请求体
+func (a *authenticator) verify(header http.Header, body []byte) error {
+	if a.token != "" {
+		token, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			return errors.New("invalid bearer token")
+		}
+	}
+	if len(a.hmacSecret) > 0 {
+		signature, ok := strings.CutPrefix(header.Get(a.hmacHeader), "sha256=")
+		got, err := hex.DecodeString(signature)
+		if !ok || err != nil {
+			return fmt.Errorf("missing or malformed %s header", a.hmacHeader)
+		}
+		mac := hmac.New(sha256.New, a.hmacSecret)
+		mac.Write(body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return errors.New("invalid hmac signature")
+		}
+	}
+	return nil
+}
+
+// tlsConfig 根据配置返回 TLS 配置，未配置证书时返回 nil 表示使用 HTTP
+func tlsConfig(cfg conf.FalcoConfig) (*tls.Config, error) {
+	if cfg.TLSCert == "" && cfg.TLSKey == "" {
+		if cfg.ClientCA != "" {
+			return nil, errors.New("falco clientCA requires tlsCert and tlsKey")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load falco tls certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCA != "" {
+		pem, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read falco client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// warnIfExposed 在监听非回环地址且没有任何认证时打印警告
+func warnIfExposed(cfg conf.FalcoConfig, auth *authenticator, tlsConf *tls.Config) {
+	if auth.enabled() || (tlsConf != nil && tlsConf.ClientCAs != nil) {
+		return
+	}
+	host, _, err := net.SplitHostPort(cfg.Listen)
+	if err == nil && host != "" {
+		if ip := net.ParseIP(host); (ip != nil && ip.IsLoopback()) || host == "localhost" {
+			return
+		}
+	}
+	log.Printf("Warning: Falco alert server on %s accepts unauthenticated alerts, configure falco.tokenEnv, falco.hmacSecretEnv or falco.clientCA", cfg.Listen)
+}
@@ -0,0 +1,99 @@
+package falco
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// rawAlert 是各种输入中告警的共同结构。Falco 的 http_output、json_output、gRPC outputs
+// 以及 falcosidekick 的 webhook 都包含 rule 和 output_fields，其余字段被忽略
+type rawAlert struct {
+	Rule         string         `json:"rule"`
+	OutputFields map[string]any `json:"output_fields"`
+}
+
+// ParseAlerts 解析一个 JSON 告警或告警数组。数据前的非 JSON 前缀（例如日志中的时间戳）会被忽略，
+// output_fields 中的值可以是字符串或数字
+func ParseAlerts(data []byte) ([]Alert, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty alert")
+	}
+	if data[0] != '{' && data[0] != '[' {
+		i := bytes.IndexByte(data, '{')
+		if i < 0 {
+			return nil, errors.New("no JSON object found")
+		}
+		data = data[i:]
+	}
+
+	var raws []rawAlert
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &raws); err != nil {
+			return nil, err
+		}
+	} else {
+		var raw rawAlert
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		raws = append(raws, raw)
+	}
+
+	alerts := make([]Alert, 0, len(raws))
+	for _, raw := range raws {
+		if raw.Rule == "" {
+			return nil, errors.New("missing rule")
+		}
+		alerts = append(alerts, NormalizeAlert(raw.Rule, raw.OutputFields))
+	}
+	return alerts, nil
+}
+
+// NormalizeAlert 将规则名和 output_fields 转换为告警
+func NormalizeAlert(rule string, fields map[string]any) Alert {
+	str := func(key string) string {
+		return fieldString(fields[key])
+	}
+	port, _ := strconv.Atoi(str("fd.sport"))
+	return Alert{
+		Rule: rule,
+		OutputFields: OutputFields{
+			Pod:          str("k8s.pod.name"),
+			Namespace:    str("k8s.ns.name"),
+			Container:    str("container.name"),
+			K8sContainer: str("k8s.container.name"),
+			Syscall:      str("evt.type"),
+			File:         str("fd.name"),
+			ServerIP:     str("fd.sip"),
+			ServerPort:   port,
+			ClientIP:     str("fd.cip"),
+			Protocol:     str("fd.l4proto"),
+			Process:      str("proc.exepath"),
+			UID:          str("user.uid"),
+			GID:          str("group.gid"),
+		},
+	}
+}
+
+// fieldString 将 JSON 值转换为字符串，缺失的字段和 Falco 的 <NA> 返回空字符串
+func fieldString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if v == "<NA>" {
+			return ""
+		}
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
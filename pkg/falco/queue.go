@@ -0,0 +1,289 @@
+package falco
+
+import (
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/model"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxSeen 是去重集合的上限，超过后清空重新记录，避免长时间观测时内存无限增长
+const maxSeen = 200000
+
+const (
+	kindFile       = "file"
+	kindCapability = "capability"
+	kindSyscall    = "syscall"
+	kindCapture    = "capture" // 容器的告警来自捕获所有系统调用的规则
+	kindProcess    = "process"
+	kindUser       = "user"
+	kindWriter     = "writer"
+	kindListen     = "listen"
+	kindConnection = "connection"
+)
+
+// observation 是从告警中提取的一条待写入的观测
+type observation struct {
+	kind      string
+	namespace string
+	pod       string
+	container string
+	value     string
+	conn      db.Connection
+}
+
+func (o observation) key() string {
+	if o.kind == kindConnection {
+		return fmt.Sprintf("%s|%s|%s|%s|%s|%d|%s", o.kind, o.namespace, o.pod, o.conn.Direction, o.conn.PeerIP, o.conn.Port, o.conn.Protocol)
+	}
+	return o.kind + "|" + o.namespace + "|" + o.pod + "|" + o.container + "|" + o.value
+}
+
+// Stats 是告警处理管道的计数
+type Stats struct {
+	Alerts        uint64 `json:"alerts"`        // 接收的告警数
+	Malformed     uint64 `json:"malformed"`     // 无法解析而被跳过的告警数
+	Enqueued      uint64 `json:"enqueued"`      // 进入队列的观测数
+	Deduplicated  uint64 `json:"deduplicated"`  // 已记录过而被跳过的观测数
+	Dropped       uint64 `json:"dropped"`       // 队列已满而被丢弃的观测数
+	Written       uint64 `json:"written"`       // 已写入数据库的观测数
+	Failed        uint64 `json:"failed"`        // 写入失败的观测数
+	Batches       uint64 `json:"batches"`       // 写入数据库的批次数
+	QueueLength   int    `json:"queueLength"`   // 当前队列中的观测数
+	QueueCapacity int    `json:"queueCapacity"` // 队列容量
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("alerts=%d malformed=%d enqueued=%d deduplicated=%d dropped=%d written=%d failed=%d batches=%d queue=%d/%d",
+		s.Alerts, s.Malformed, s.Enqueued, s.Deduplicated, s.Dropped, s.Written, s.Failed, s.Batches, s.QueueLength, s.QueueCapacity)
+}
+
+// pipeline 将告警中的观测放入有界队列，由单独的写入协程去重后批量写入数据库
+type pipeline struct {
+	queue          chan observation
+	batchSize      int
+	flushInterval  time.Duration
+	enqueueTimeout time.Duration
+	resolve        func(namespace, pod string) model.Workload
+	resolvePeer    func(c db.Connection) db.ConnectionPeer
+
+	mu      sync.Mutex
+	seen    map[string]struct{}
+	samples map[[2]string]int64 // 每个 Pod（命名空间、名称）收到的观测条数，包括已去重的
+
+	alerts, malformed, enqueued, deduplicated, dropped, written, failed, batches atomic.Uint64
+}
+
+func newPipeline(cfg conf.FalcoConfig, resolve func(namespace, pod string) model.Workload, resolvePeer func(c db.Connection) db.ConnectionPeer) *pipeline {
+	return &pipeline{
+		queue:          make(chan observation, cfg.QueueSize),
+		batchSize:      cfg.BatchSize,
+		flushInterval:  time.Duration(cfg.FlushInterval) * time.Millisecond,
+		enqueueTimeout: time.Duration(cfg.EnqueueTimeout) * time.Millisecond,
+		resolve:        resolve,
+		resolvePeer:    resolvePeer,
+		seen:           map[string]struct{}{},
+		samples:        map[[2]string]int64{},
+	}
+}
+
+// submit 将一个告警的观测放入队列，已记录过的观测会被跳过。
+// 队列已满且在 timeout 内没有空位时丢弃观测并返回 false，timeout 为负数时一直等待
+func (p *pipeline) submit(observations []observation, timeout time.Duration) bool {
+	p.alerts.Add(1)
+	accepted := true
+	for _, o := range observations {
+		p.countSample(o.namespace, o.pod)
+		if !p.markSeen(o.key()) {
+			p.deduplicated.Add(1)
+			continue
+		}
+		if !p.enqueue(o, timeout) {
+			p.unmarkSeen(o.key())
+			p.dropped.Add(1)
+			accepted = false
+			continue
+		}
+		p.enqueued.Add(1)
+	}
+	return accepted
+}
+
+func (p *pipeline) enqueue(o observation, timeout time.Duration) bool {
+	select {
+	case p.queue <- o:
+		return true
+	default:
+	}
+	if timeout < 0 {
+		p.queue <- o
+		return true
+	}
+	if timeout == 0 {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case p.queue <- o:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// markSeen 记录观测，观测已记录过时返回 false
+func (p *pipeline) markSeen(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.seen[key]; ok {
+		return false
+	}
+	if len(p.seen) >= maxSeen {
+		p.seen = map[string]struct{}{}
+	}
+	p.seen[key] = struct{}{}
+	return true
+}
+
+func (p *pipeline) unmarkSeen(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.seen, key)
+}
+
+func (p *pipeline) countSample(namespace, pod string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.samples[[2]string{namespace, pod}]++
+}
+
+// takeSamples 返回上次调用以来每个 Pod 收到的观测条数并清零
+func (p *pipeline) takeSamples() map[[2]string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	samples := p.samples
+	p.samples = map[[2]string]int64{}
+	return samples
+}
+
+func (p *pipeline) hasSamples() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.samples) > 0
+}
+
+// run 批量写入队列中的观测，直到 stop 关闭。关闭后写完队列中剩余的观测再返回，
+// 因此调用方应先停止接收告警
+func (p *pipeline) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+	batch := make([]observation, 0, p.batchSize)
+	add := func(o observation) {
+		batch = append(batch, o)
+		if len(batch) >= p.batchSize {
+			p.write(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case o := <-p.queue:
+			add(o)
+		case <-ticker.C:
+			// 观测全部被去重时也要写入，以更新覆盖情况
+			if len(batch) > 0 || p.hasSamples() {
+				p.write(batch)
+				batch = batch[:0]
+			}
+		case <-stop:
+			for {
+				select {
+				case o := <-p.queue:
+					add(o)
+				default:
+					if len(batch) > 0 || p.hasSamples() {
+						p.write(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// write 解析观测所属的工作负载并写入数据库，失败时取消去重记录，使之后重复的告警可以重新写入
+func (p *pipeline) write(batch []observation) {
+	workloads := map[string]model.Workload{}
+	workload := func(namespace, pod string) model.Workload {
+		key := namespace + "/" + pod
+		if w, ok := workloads[key]; ok {
+			return w
+		}
+		workloads[key] = p.resolve(namespace, pod)
+		return workloads[key]
+	}
+
+	b := db.ObservationBatch{Samples: map[model.Workload]int64{}}
+	for pod, n := range p.takeSamples() {
+		b.Samples[workload(pod[0], pod[1])] += n
+	}
+	for _, o := range batch {
+		v := db.ObservedValue{Pod: o.pod, Workload: workload(o.namespace, o.pod), Container: o.container, Value: o.value}
+		switch o.kind {
+		case kindFile:
+			b.Files = append(b.Files, v)
+		case kindCapability:
+			b.Capabilities = append(b.Capabilities, v)
+		case kindSyscall:
+			b.Syscalls = append(b.Syscalls, v)
+		case kindCapture:
+			b.SyscallCapture = append(b.SyscallCapture, v)
+		case kindProcess:
+			b.Processes = append(b.Processes, v)
+		case kindUser:
+			b.Users = append(b.Users, v)
+		case kindWriter:
+			b.Writers = append(b.Writers, v)
+		case kindListen:
+			b.Listening = append(b.Listening, v)
+		case kindConnection:
+			conn := o.conn
+			conn.Workload = v.Workload
+			conn.Peer = p.resolvePeer(conn)
+			b.Connections = append(b.Connections, conn)
+		}
+	}
+
+	if len(batch) > 0 {
+		p.batches.Add(1)
+	}
+	if err := db.WriteObservations(b); err != nil {
+		log.Printf("Failed to write %d observations: %v", len(batch), err)
+		p.failed.Add(uint64(len(batch)))
+		for _, o := range batch {
+			p.unmarkSeen(o.key())
+		}
+		return
+	}
+	p.written.Add(uint64(len(batch)))
+}
+
+func (p *pipeline) stats() Stats {
+	return Stats{
+		Alerts:        p.alerts.Load(),
+		Malformed:     p.malformed.Load(),
+		Enqueued:      p.enqueued.Load(),
+		Deduplicated:  p.deduplicated.Load(),
+		Dropped:       p.dropped.Load(),
+		Written:       p.written.Load(),
+		Failed:        p.failed.Load(),
+		Batches:       p.batches.Load(),
+		QueueLength:   len(p.queue),
+		QueueCapacity: cap(p.queue),
+	}
+}
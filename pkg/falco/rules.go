@@ -0,0 +1,229 @@
+package falco
+
+import (
+	"bytes"
+	"fmt"
+	"kubefix-cli/conf"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule 是 kubefix 依赖的一条 Falco 规则。告警按规则名称在注册表中查找，
+// 文件和 capability 只从注册过的规则中提取；系统调用、程序执行和连接是事件本身的事实，从任何告警中提取
+type Rule struct {
+	Name       string
+	Desc       string
+	Condition  string // 不含命名空间范围的条件
+	Output     string // 告警的 output_fields 来自其中引用的字段
+	Kind       string // 规则产生的观测类型
+	Capability string // capability 规则对应的 capability
+	Optional   bool   // 事件量很大，只在显式要求时生成
+}
+
+// fieldsOutput 是所有规则输出中都包含的字段
+const fieldsOutput = "ns=%k8s.ns.name pod=%k8s.pod.name container=%container.name evt.type=%evt.type proc.exepath=%proc.exepath user.uid=%user.uid group.gid=%group.gid"
+
+// capabilityRules 列出需要 capability 的系统调用
+var capabilityRules = []struct {
+	capability string
+	condition  string
+}{
+	{"CAP_CHOWN", "evt.type in (chown, fchown, lchown, fchownat)"},
+	{"CAP_FOWNER", "evt.type in (chmod, fchmod, fchmodat, utimensat) and user.uid = 0"},
+	{"CAP_SETUID", "evt.type in (setuid, setreuid, setresuid, setfsuid)"},
+	{"CAP_SETGID", "evt.type in (setgid, setregid, setresgid, setfsgid, setgroups)"},
+	{"CAP_NET_BIND_SERVICE", "evt.type = bind and fd.sport > 0 and fd.sport < 1024"},
+	{"CAP_NET_RAW", "evt.type = socket and evt.arg.type contains SOCK_RAW"},
+	{"CAP_NET_ADMIN", "evt.type = ioctl and evt.arg.request in (0x8914, 0x8916, 0x8922)"},
+	{"CAP_SYS_CHROOT", "evt.type = chroot"},
+	{"CAP_SYS_ADMIN", "evt.type in (mount, umount, umount2, pivot_root, setns, unshare, sethostname, setdomainname)"},
+	{"CAP_SYS_PTRACE", "evt.type in (ptrace, process_vm_readv, process_vm_writev)"},
+	{"CAP_SYS_TIME", "evt.type in (settimeofday, clock_settime, adjtimex, clock_adjtime)"},
+	{"CAP_SYS_MODULE", "evt.type in (init_module, finit_module, delete_module)"},
+	{"CAP_SYS_NICE", "evt.type in (setpriority, sched_setscheduler, sched_setattr)"},
+	{"CAP_SYS_RESOURCE", "evt.type in (setrlimit, prlimit)"},
+	{"CAP_MKNOD", "evt.type in (mknod, mknodat)"},
+	{"CAP_IPC_LOCK", "evt.type in (mlock, mlock2, mlockall)"},
+	{"CAP_KILL", "evt.type in (kill, tkill, tgkill) and user.uid = 0"},
+}
+
+// UnobservableCapabilities 是容器运行时默认授予、但 Falco 规则无法观测其使用的 capabilities，
+// 收紧 capabilities 时应保留容器原本拥有的这些 capability：
+// DAC_OVERRIDE 在 root 读写属于其他用户的文件时生效，Falco 不提供文件属主，而 EACCES 只在去掉它之后才会出现；
+// FSETID、SETFCAP 在写入 setuid 文件或设置文件 capabilities 时生效，SETPCAP 在调整能力集时生效，
+// AUDIT_WRITE 在向审计子系统发送消息时生效，都没有可以区分的系统调用
+var UnobservableCapabilities = []string{"CAP_DAC_OVERRIDE", "CAP_FSETID", "CAP_SETPCAP", "CAP_SETFCAP", "CAP_AUDIT_WRITE"}
+
+// Rules 是 kubefix 依赖的规则注册表
+var Rules = buildRules()
+
+func buildRules() []Rule {
+	rules := []Rule{
+		{
+			Name:      "kubefix file write",
+			Desc:      "A container opened a file for writing, used to make the root filesystem read-only",
+			Condition: "evt.type in (open, openat, openat2, creat) and evt.dir = < and evt.is_open_write = true and fd.typechar = 'f' and fd.num >= 0",
+			Output:    "kubefix file write (file=%fd.name " + fieldsOutput + ")",
+			Kind:      kindFile,
+		},
+		{
+			Name:      "kubefix process exec",
+			Desc:      "A container executed a program, used to build the process baseline",
+			Condition: "evt.type in (execve, execveat) and evt.dir = < and evt.res = 0",
+			Output:    "kubefix process exec (" + fieldsOutput + ")",
+			Kind:      kindProcess,
+		},
+		{
+			Name:      "kubefix outbound connection",
+			Desc:      "A container connected to a peer, used to generate egress NetworkPolicies",
+			Condition: "evt.type = connect and evt.dir = < and fd.typechar in (4, 6) and fd.l4proto in (tcp, udp) and fd.sip != \"127.0.0.1\"",
+			Output:    "kubefix outbound connection (fd.sip=%fd.sip fd.sport=%fd.sport fd.cip=%fd.cip fd.l4proto=%fd.l4proto " + fieldsOutput + ")",
+			Kind:      kindConnection,
+		},
+		{
+			Name:      "kubefix inbound connection",
+			Desc:      "A container accepted a connection, used to generate ingress NetworkPolicies",
+			Condition: "evt.type in (accept, accept4) and evt.dir = < and fd.typechar in (4, 6) and fd.l4proto = tcp and fd.cip != \"127.0.0.1\"",
+			Output:    "kubefix inbound connection (fd.sip=%fd.sip fd.sport=%fd.sport fd.cip=%fd.cip fd.l4proto=%fd.l4proto " + fieldsOutput + ")",
+			Kind:      kindConnection,
+		},
+		{
+			Name:      "kubefix listening socket",
+			Desc:      "A container started listening on a port, used to generate probes and check declared ports",
+			Condition: "(evt.type = listen or (evt.type = bind and fd.l4proto = udp)) and evt.dir = < and evt.res = 0 and fd.typechar in (4, 6)",
+			Output:    "kubefix listening socket (fd.sip=%fd.sip fd.sport=%fd.sport fd.l4proto=%fd.l4proto " + fieldsOutput + ")",
+			Kind:      kindListen,
+		},
+		{
+			Name:      "kubefix syscall",
+			Desc:      "A container made a syscall, used to generate seccomp profiles. Produces a very large number of events",
+			Condition: "evt.dir = <",
+			Output:    "kubefix syscall (" + fieldsOutput + ")",
+			Kind:      kindSyscall,
+			Optional:  true,
+		},
+	}
+	for _, c := range capabilityRules {
+		rules = append(rules, Rule{
+			Name:       "kubefix capability " + c.capability,
+			Desc:       fmt.Sprintf("A container made a syscall that requires %s, used to drop unused capabilities", c.capability),
+			Condition:  "evt.dir = < and " + c.condition,
+			Output:     "kubefix capability " + c.capability + " (" + fieldsOutput + ")",
+			Kind:       kindCapability,
+			Capability: c.capability,
+		})
+	}
+	return rules
+}
+
+// registry 按名称索引 Rules
+var registry = func() map[string]Rule {
+	m := map[string]Rule{}
+	for _, r := range Rules {
+		m[r.Name] = r
+	}
+	return m
+}()
+
+// lookupRule 返回名称对应的已注册规则
+func lookupRule(name string) (Rule, bool) {
+	r, ok := registry[name]
+	return r, ok
+}
+
+// rulesEntry 是 Falco 规则文件中的一项：list、macro 或 rule
+type rulesEntry struct {
+	List      string   `yaml:"list,omitempty"`
+	Items     []string `yaml:"items,omitempty"`
+	Macro     string   `yaml:"macro,omitempty"`
+	Rule      string   `yaml:"rule,omitempty"`
+	Desc      string   `yaml:"desc,omitempty"`
+	Condition string   `yaml:"condition,omitempty"`
+	Output    string   `yaml:"output,omitempty"`
+	Priority  string   `yaml:"priority,omitempty"`
+	Tags      []string `yaml:"tags,omitempty"`
+}
+
+// RulesFile 生成只产生 kubefix 所需事件的 Falco 规则文件，ignoredNamespaces 中的命名空间不会产生告警。
+// syscalls 为 true 时包含记录所有系统调用的规则
+func RulesFile(ignoredNamespaces []string, syscalls bool) ([]byte, error) {
+	items := ignoredNamespaces
+	if len(items) == 0 {
+		// Falco 不接受空列表，使用一个不存在的命名空间占位
+		items = []string{"kubefix-none"}
+	}
+	entries := []rulesEntry{
+		{List: "kubefix_ignored_namespaces", Items: items},
+		{Macro: "kubefix_scope", Condition: "container.id != host and k8s.ns.name != \"\" and not k8s.ns.name in (kubefix_ignored_namespaces)"},
+	}
+	for _, r := range Rules {
+		if r.Optional && !syscalls {
+			continue
+		}
+		entries = append(entries, rulesEntry{
+			Rule:      r.Name,
+			Desc:      r.Desc,
+			Condition: "kubefix_scope and " + r.Condition,
+			Output:    r.Output,
+			Priority:  "INFORMATIONAL",
+			Tags:      []string{"kubefix", r.Kind},
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by kubefix-cli falco-config. Rules emit exactly the events kubefix observes.\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(entries); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// HelmValues 生成 falcosecurity/falco Helm chart 的 values，加载 kubefix 规则并通过 http_output 将告警发送到 url
+func HelmValues(url string, rules []byte, cfg conf.FalcoConfig) ([]byte, error) {
+	httpOutput := map[string]any{
+		"enabled":    true,
+		"url":        url,
+		"user_agent": "falcosecurity/falco",
+	}
+	if cfg.ClientCA != "" {
+		httpOutput["mtls"] = true
+		httpOutput["client_cert"] = "/etc/falco/certs/client.crt"
+		httpOutput["client_key"] = "/etc/falco/certs/client.key"
+		httpOutput["ca_cert"] = "/etc/falco/certs/ca.crt"
+	}
+	values := map[string]any{
+		"driver": map[string]any{"kind": "modern_ebpf"},
+		"falco": map[string]any{
+			"json_output":                         true,
+			"json_include_output_property":        true,
+			"json_include_tags_property":          true,
+			"priority":                            "informational",
+			"http_output":                         httpOutput,
+			"rules_files":                         []string{"/etc/falco/rules.d"},
+			"buffered_outputs":                    false,
+			"outputs_queue":                       map[string]any{"capacity": 0},
+			"json_include_message_property":       false,
+			"json_include_output_fields_property": true,
+		},
+		"customRules": map[string]any{"kubefix_rules.yaml": string(rules)},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by kubefix-cli falco-config. Install with:\n")
+	buf.WriteString("#   helm install falco falcosecurity/falco -n falco --create-namespace -f falco-values.yaml\n")
+	if cfg.TokenEnv != "" || cfg.HMACSecretEnv != "" {
+		buf.WriteString("# Falco http_output cannot send bearer tokens or HMAC signatures; route alerts through\n")
+		buf.WriteString("# falcosidekick's webhook output with customheaders, or use falco.clientCA for mTLS.\n")
+	}
+	if cfg.ClientCA != "" {
+		buf.WriteString("# Mount the client certificate, key and CA into /etc/falco/certs with mounts.volumes and mounts.volumeMounts.\n")
+	}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
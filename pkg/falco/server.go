@@ -1,20 +1,22 @@
-// Package falco provides functionality to handle Falco alerts and update capabilities
+// Package falco ingests runtime security events from Falco and Tetragon and stores the observed capabilities, files, syscalls, processes and connections
 package falco
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/client"
 	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/model"
 	"log"
 	"net/http"
 	"regexp"
 	"strings"
-)
-
-var (
-	filesystemSig = "Filesystem"
-	capabilitySig = "CAP_"
+	"sync/atomic"
+	"time"
 )
 
 type Alert struct {
@@ -23,54 +25,261 @@ type Alert struct {
 }
 
 type OutputFields struct {
-	Pod       string `json:"k8s.pod.name"`
-	Namespace string `json:"k8s.ns.name"`
-	Syscall   string `json:"evt.type"`
-	File      string `json:"fd.name"`
+	Pod          string `json:"k8s.pod.name"`
+	Namespace    string `json:"k8s.ns.name"`
+	Container    string `json:"container.name"`
+	K8sContainer string `json:"k8s.container.name"`
+	Syscall      string `json:"evt.type"`
+	File         string `json:"fd.name"`
+	ServerIP     string `json:"fd.sip"`
+	ServerPort   int    `json:"fd.sport"`
+	ClientIP     string `json:"fd.cip"`
+	Protocol     string `json:"fd.l4proto"`
+	Process      string `json:"proc.exepath"`
+	UID          string `json:"user.uid"`
+	GID          string `json:"group.gid"`
 }
 
-func FindCapability(s string) string {
-	re := regexp.MustCompile(`CAP_\w+`)
-	return re.FindString(s)
+// Connection 将 connect/accept 事件转换为连接记录，其他事件返回 false
+func (f OutputFields) Connection() (db.Connection, bool) {
+	c := db.Connection{Pod: f.Pod, Port: f.ServerPort, Protocol: strings.ToUpper(f.Protocol)}
+	switch f.Syscall {
+	case "connect":
+		c.Direction = db.DirectionEgress
+		c.PeerIP = f.ServerIP
+	case "accept", "accept4":
+		c.Direction = db.DirectionIngress
+		c.PeerIP = f.ClientIP
+	default:
+		return c, false
+	}
+	if c.Pod == "" || c.PeerIP == "" || c.Port == 0 || (c.Protocol != "TCP" && c.Protocol != "UDP") {
+		return c, false
+	}
+	return c, true
 }
 
-func alertHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
-		return
+// ListeningPort 将 TCP 的 listen 和 UDP 的 bind 事件转换为端口/协议形式的监听端口。
+// 只监听回环地址的端口无法被 kubelet 探测，与其他事件一样返回 false
+func (f OutputFields) ListeningPort() (string, bool) {
+	protocol := strings.ToUpper(f.Protocol)
+	switch {
+	case f.Syscall == "listen":
+		protocol = "TCP"
+	case f.Syscall == "bind" && protocol == "UDP":
+	default:
+		return "", false
 	}
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusInternalServerError)
-		return
+	if f.ServerPort <= 0 || strings.HasPrefix(f.ServerIP, "127.") || f.ServerIP == "::1" {
+		return "", false
 	}
-	alert := Alert{}
-	err = json.Unmarshal(body, &alert)
+	return fmt.Sprintf("%d/%s", f.ServerPort, protocol), true
+}
+
+// Identity 返回进程 uid:gid 形式的身份，没有 uid 时返回空字符串
+func (f OutputFields) Identity() string {
+	if !idRe.MatchString(f.UID) {
+		return ""
+	}
+	if !idRe.MatchString(f.GID) {
+		return f.UID + ":"
+	}
+	return f.UID + ":" + f.GID
+}
+
+// ContainerName 返回告警所属的容器名称
+func (f OutputFields) ContainerName() string {
+	if f.K8sContainer != "" {
+		return f.K8sContainer
+	}
+	return f.Container
+}
+
+var (
+	syscallRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+	idRe      = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// lastStats 保存最近一次退出的告警处理管道的计数
+var lastStats atomic.Value
+
+// PipelineStats 返回最近一次退出的告警处理管道的计数，服务器未运行过时返回 false
+func PipelineStats() (Stats, bool) {
+	s, ok := lastStats.Load().(Stats)
+	return s, ok
+}
+
+// owners 将告警中的 Pod 解析为其所属工作负载
+var owners *client.OwnerResolver
+
+// resolveWorkload 返回 Pod 所属的工作负载，无法解析时将 Pod 自身视为工作负载
+func resolveWorkload(namespace, pod string) model.Workload {
+	if owners == nil {
+		return model.Workload{Namespace: namespace, Kind: "Pod", Name: pod}
+	}
+	workload, err := owners.Resolve(namespace, pod)
 	if err != nil {
+		fmt.Printf("Failed to resolve owner of pod %s/%s: %v\n", namespace, pod, err)
+	}
+	return workload
+}
+
+// peers 将连接的对端 IP 解析为 Pod 或 Service
+var peers *client.PeerResolver
+
+// resolvePeer 在观测时解析连接的对端。Pod IP 会随 Pod 重建而变化或被复用，不能留到生成策略时再解析
+func resolvePeer(c db.Connection) db.ConnectionPeer {
+	if peers == nil {
+		return db.ConnectionPeer{}
+	}
+	peer, ok := peers.Resolve(c.PeerIP, c.Port, c.Protocol)
+	if !ok {
+		return db.ConnectionPeer{}
+	}
+	return db.ConnectionPeer{Namespace: peer.Namespace, Labels: peer.Labels, Service: peer.Service, Addresses: peer.Addresses, Port: peer.Port}
+}
+
+// alertHandler 返回处理告警的 HTTP 处理器，接受 Falco http_output 的单个告警、falcosidekick webhook 的负载
+// 或告警数组。请求体超过 maxBody 字节、认证失败或不是合法 JSON 的告警会被拒绝；队列已满时返回 503
+func alertHandler(auth *authenticator, maxBody int64, p *pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		if err := auth.verify(r.Header, body); err != nil {
+			log.Printf("Rejected alert from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		alerts, err := ParseAlerts(body)
+		if err != nil {
+			p.malformed.Add(1)
+			http.Error(w, "Malformed alert: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		accepted := true
+		for _, alert := range alerts {
+			accepted = p.submit(observations(alert), p.enqueueTimeout) && accepted
+		}
+		if !accepted {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Observation queue is full", http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
+}
 
-	if strings.Contains(alert.Rule, filesystemSig) {
-		err = db.UpdateFiles(alert.OutputFields.Pod, alert.OutputFields.Namespace, alert.OutputFields.File)
-	} else if strings.Contains(alert.Rule, capabilitySig) {
-		capability := FindCapability(alert.OutputFields.Syscall)
-		if capability != "" {
-			err = db.UpdateCaps(alert.OutputFields.Pod, alert.OutputFields.Namespace, capability)
+// statsHandler 以 JSON 返回告警处理管道的计数，与告警使用相同的认证，启用 HMAC 时对空请求体签名
+func statsHandler(auth *authenticator, p *pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.verify(r.Header, nil); err != nil {
+			log.Printf("Rejected stats request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.stats())
 	}
-	if err != nil {
-		fmt.Printf("Failed to update database: %v\n", err)
+}
+
+// observations 提取告警中的观测。文件和 capability 只从注册表中的规则提取，其余观测从任何告警中提取
+func observations(alert Alert) []observation {
+	fields := alert.OutputFields
+	if fields.Pod == "" {
+		return nil
+	}
+	base := observation{namespace: fields.Namespace, pod: fields.Pod, container: fields.ContainerName()}
+	var result []observation
+	add := func(kind, value string) {
+		o := base
+		o.kind, o.value = kind, value
+		result = append(result, o)
 	}
 
-	fmt.Println("Received alert:", alert.Rule, alert.OutputFields.Pod, alert.OutputFields.Syscall)
-	// fmt.Println("Received alert:", string(body))
-	w.WriteHeader(http.StatusOK)
+	identity := fields.Identity()
+	if identity != "" {
+		add(kindUser, identity)
+	}
+	if rule, ok := lookupRule(alert.Rule); ok {
+		switch {
+		case rule.Kind == kindFile && fields.File != "":
+			add(kindFile, fields.File)
+			if identity != "" {
+				add(kindWriter, identity)
+			}
+		case rule.Kind == kindCapability:
+			add(kindCapability, rule.Capability)
+		case rule.Kind == kindSyscall:
+			add(kindCapture, "")
+		}
+	}
+	if syscallRe.MatchString(fields.Syscall) {
+		add(kindSyscall, fields.Syscall)
+	}
+	if (fields.Syscall == "execve" || fields.Syscall == "execveat") && fields.Process != "" {
+		add(kindProcess, fields.Process)
+	}
+	if port, ok := fields.ListeningPort(); ok {
+		add(kindListen, port)
+	}
+	if conn, ok := fields.Connection(); ok {
+		o := base
+		o.kind, o.conn = kindConnection, conn
+		result = append(result, o)
+	}
+	return result
 }
 
-func StartFalcoAlertServer() {
-	http.HandleFunc("/alert", alertHandler)
-	log.Println("Falco alert server listening on :8999")
-	if err := http.ListenAndServe(":8999", nil); err != nil {
-		log.Fatalf("Falco alert server error: %v", err)
+// serveHTTP 通过 HTTP 接收告警直到 ctx 结束，结束时等待正在处理的请求完成后关闭服务器
+func serveHTTP(ctx context.Context, cfg conf.FalcoConfig, p *pipeline) error {
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+	tlsConf, err := tlsConfig(cfg)
+	if err != nil {
+		return err
+	}
+	warnIfExposed(cfg, auth, tlsConf)
+
+	mux := http.NewServeMux()
+	mux.Handle("/alert", alertHandler(auth, cfg.MaxBodyBytes, p))
+	mux.Handle("/stats", statsHandler(auth, p))
+	server := &http.Server{Addr: cfg.Listen, Handler: mux, TLSConfig: tlsConf, ReadHeaderTimeout: 10 * time.Second}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if tlsConf != nil {
+			log.Printf("Falco alert server listening on %s (TLS)", cfg.Listen)
+			errCh <- server.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("Falco alert server listening on %s", cfg.Listen)
+		errCh <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("falco alert server: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown falco alert server: %w", err)
 	}
+	log.Println("Falco alert server stopped")
+	return nil
 }
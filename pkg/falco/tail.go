@@ -0,0 +1,108 @@
+package falco
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// tailInterval 是文件没有新内容时的轮询间隔
+const tailInterval = 500 * time.Millisecond
+
+// tailFile 持续读取 Falco 的 json_output 文件或标准输出日志，直到 ctx 结束。
+// 文件被轮转或截断时重新从头读取
+func tailFile(ctx context.Context, path string, fromStart bool, p *pipeline) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer func() { f.Close() }()
+	if !fromStart {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			return fmt.Errorf("seek %s: %w", path, err)
+		}
+	}
+	log.Printf("Following Falco alerts in %s", path)
+
+	reader := bufio.NewReader(f)
+	var partial []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == nil {
+			submitLine(bytes.TrimSpace(append(partial, line...)), p)
+			partial = partial[:0]
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		// 保留未写完的行，等待剩余部分
+		partial = append(partial, line...)
+		if len(partial) > maxLineBytes {
+			p.malformed.Add(1)
+			partial = partial[:0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tailInterval):
+		}
+
+		rotated, err := fileRotated(f, path)
+		if err != nil {
+			return err
+		}
+		if rotated {
+			log.Printf("%s was rotated or truncated, reading from the start", path)
+			// 读完旧文件中轮转前写入的内容
+			for {
+				line, err := reader.ReadBytes('\n')
+				partial = append(partial, line...)
+				if err != nil {
+					break
+				}
+				submitLine(bytes.TrimSpace(partial), p)
+				partial = partial[:0]
+			}
+			next, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("reopen %s: %w", path, err)
+			}
+			f.Close()
+			f = next
+			reader.Reset(f)
+			partial = partial[:0]
+		}
+	}
+}
+
+// fileRotated 判断路径是否已指向另一个文件，或当前文件是否被截断
+func fileRotated(f *os.File, path string) (bool, error) {
+	current, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", path, err)
+	}
+	latest, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// 轮转后新文件尚未创建
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", path, err)
+	}
+	if !os.SameFile(current, latest) {
+		return true, nil
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, fmt.Errorf("seek %s: %w", path, err)
+	}
+	return latest.Size() < offset, nil
+}
@@ -0,0 +1,231 @@
+package falco
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// tetragonEvent 是 Tetragon JSON 导出中的一行事件，只解析与观测相关的字段
+type tetragonEvent struct {
+	ProcessExec *struct {
+		Process tetragonProcess `json:"process"`
+	} `json:"process_exec"`
+	ProcessKprobe     *tetragonHook `json:"process_kprobe"`
+	ProcessTracepoint *tetragonHook `json:"process_tracepoint"`
+	ProcessLSM        *tetragonHook `json:"process_lsm"`
+}
+
+type tetragonProcess struct {
+	Binary string `json:"binary"`
+	UID    *int64 `json:"uid"`
+	// 开启 --enable-process-cred 时才有，值为 0 的字段会被省略
+	Credentials *struct {
+		EUID int64 `json:"euid"`
+		EGID int64 `json:"egid"`
+	} `json:"process_credentials"`
+	Pod *struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		Container struct {
+			Name string `json:"name"`
+		} `json:"container"`
+	} `json:"pod"`
+}
+
+// tetragonHook 是 kprobe、tracepoint 和 LSM 事件的共同结构
+type tetragonHook struct {
+	Process      tetragonProcess `json:"process"`
+	FunctionName string          `json:"function_name"`
+	Subsys       string          `json:"subsys"`
+	Event        string          `json:"event"`
+	Args         []tetragonArg   `json:"args"`
+}
+
+type tetragonArg struct {
+	FileArg *struct {
+		Path string `json:"path"`
+	} `json:"file_arg"`
+	PathArg *struct {
+		Path string `json:"path"`
+	} `json:"path_arg"`
+	IntArg        *int64 `json:"int_arg"`
+	CapabilityArg *struct {
+		Value int64  `json:"value"`
+		Name  string `json:"name"`
+	} `json:"capability_arg"`
+}
+
+// identity 返回进程 uid:gid 形式的有效身份，没有 uid 时返回空字符串
+func (p tetragonProcess) identity() string {
+	if c := p.Credentials; c != nil {
+		return fmt.Sprintf("%d:%d", c.EUID, c.EGID)
+	}
+	if p.UID != nil {
+		return fmt.Sprintf("%d:", *p.UID)
+	}
+	return ""
+}
+
+func (a tetragonArg) path() string {
+	switch {
+	case a.FileArg != nil:
+		return a.FileArg.Path
+	case a.PathArg != nil:
+		return a.PathArg.Path
+	}
+	return ""
+}
+
+// isTetragonEvent 判断一行 JSON 是否为 Tetragon 事件
+func isTetragonEvent(line []byte) bool {
+	var keys map[string]json.RawMessage
+	if json.Unmarshal(line, &keys) != nil {
+		return false
+	}
+	for _, k := range []string{"process_exec", "process_kprobe", "process_tracepoint", "process_lsm", "process_exit"} {
+		if _, ok := keys[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tetragonWriteHooks 是意味着写入其路径参数的内核函数
+var tetragonWriteHooks = map[string]bool{
+	"security_path_truncate": true, "security_path_mknod": true, "security_path_mkdir": true,
+	"security_path_unlink": true, "security_path_rmdir": true, "security_path_rename": true,
+	"security_path_symlink": true, "security_path_link": true, "security_path_chmod": true,
+	"security_path_chown": true, "security_inode_create": true, "security_file_truncate": true,
+	"vfs_write": true, "vfs_writev": true, "vfs_truncate": true,
+}
+
+// tetragonWriteSyscalls 是写入其文件参数的系统调用
+var tetragonWriteSyscalls = map[string]bool{
+	"write": true, "pwrite64": true, "writev": true, "pwritev": true, "pwritev2": true,
+	"truncate": true, "ftruncate": true, "fallocate": true, "mkdir": true, "mkdirat": true,
+	"unlink": true, "unlinkat": true, "rename": true, "renameat": true, "renameat2": true,
+	"creat": true, "mknod": true, "mknodat": true, "chmod": true, "fchmod": true, "fchmodat": true,
+}
+
+// 内核文件访问掩码中的写入和追加位
+const (
+	mayWrite  = 0x2
+	mayAppend = 0x8
+)
+
+// tetragonObservations 将 Tetragon 事件映射为与 Falco 告警相同的观测：
+// process_exec 记录执行的程序和 execve，kprobe 与 tracepoint 记录系统调用、写入的文件和检查的 capability
+func tetragonObservations(event tetragonEvent) []observation {
+	var result []observation
+	add := func(p tetragonProcess, kind, value string) {
+		if p.Pod == nil || p.Pod.Name == "" || value == "" {
+			return
+		}
+		result = append(result, observation{kind: kind, namespace: p.Pod.Namespace, pod: p.Pod.Name, container: p.Pod.Container.Name, value: value})
+	}
+
+	if e := event.ProcessExec; e != nil {
+		add(e.Process, kindProcess, e.Process.Binary)
+		add(e.Process, kindUser, e.Process.identity())
+		add(e.Process, kindSyscall, "execve")
+	}
+	for _, hook := range []*tetragonHook{event.ProcessKprobe, event.ProcessTracepoint, event.ProcessLSM} {
+		if hook == nil {
+			continue
+		}
+		syscall := hook.syscall()
+		if syscallRe.MatchString(syscall) {
+			add(hook.Process, kindSyscall, syscall)
+		}
+		if path := hook.writtenPath(syscall); path != "" {
+			add(hook.Process, kindFile, path)
+			add(hook.Process, kindWriter, hook.Process.identity())
+		}
+		if capability := hook.capability(); capability != "" {
+			add(hook.Process, kindCapability, capability)
+		}
+	}
+	return result
+}
+
+// syscall 返回挂载点对应的系统调用名称，例如 __x64_sys_openat 或 syscalls/sys_enter_openat 对应 openat
+func (h *tetragonHook) syscall() string {
+	if h.Subsys == "syscalls" {
+		if name, ok := strings.CutPrefix(h.Event, "sys_enter_"); ok {
+			return name
+		}
+		return ""
+	}
+	for _, prefix := range []string{"__x64_sys_", "__arm64_sys_", "__ia32_sys_", "__se_sys_", "sys_"} {
+		if name, ok := strings.CutPrefix(h.FunctionName, prefix); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// writtenPath 返回事件写入的文件路径，事件不是写入时返回空字符串
+func (h *tetragonHook) writtenPath(syscall string) string {
+	path := ""
+	for _, arg := range h.Args {
+		if path = arg.path(); path != "" {
+			break
+		}
+	}
+	if path == "" || !strings.HasPrefix(path, "/") {
+		return ""
+	}
+	switch {
+	case tetragonWriteHooks[h.FunctionName], tetragonWriteSyscalls[syscall]:
+		return path
+	case h.FunctionName == "security_file_permission" || h.FunctionName == "file_permission":
+		for _, arg := range h.Args {
+			if arg.IntArg != nil && *arg.IntArg&(mayWrite|mayAppend) != 0 {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// capability 返回 cap_capable 事件检查的 capability
+func (h *tetragonHook) capability() string {
+	for _, arg := range h.Args {
+		if arg.CapabilityArg != nil {
+			if arg.CapabilityArg.Name != "" {
+				return arg.CapabilityArg.Name
+			}
+			return capabilityName(arg.CapabilityArg.Value)
+		}
+	}
+	if h.FunctionName != "cap_capable" {
+		return ""
+	}
+	// cap_capable(cred, ns, cap, opts)，capability 是第一个整数参数
+	for _, arg := range h.Args {
+		if arg.IntArg != nil {
+			return capabilityName(*arg.IntArg)
+		}
+	}
+	return ""
+}
+
+// capabilities 按编号列出 Linux capability
+var capabilities = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL",
+	"CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP", "CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST", "CAP_NET_ADMIN", "CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER",
+	"CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT", "CAP_SYS_PTRACE", "CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE", "CAP_SYS_RESOURCE", "CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG", "CAP_MKNOD", "CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP", "CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND", "CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF", "CAP_CHECKPOINT_RESTORE",
+}
+
+func capabilityName(n int64) string {
+	if n < 0 || n >= int64(len(capabilities)) {
+		return ""
+	}
+	return capabilities[n]
+}
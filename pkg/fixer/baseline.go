@@ -0,0 +1,46 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/falco"
+)
+
+// ObservedBaseline 汇总工作负载每个容器在 observe 期间执行的程序、写入的文件和使用的 capabilities，
+// 没有记录过该工作负载的程序执行、文件写入或 capability 时返回 nil，只有指标、连接或系统调用数据不足以生成基线
+func ObservedBaseline(m *Manifest) (*falco.Baseline, error) {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %s", m.Kind())
+	}
+	caps, _, err := ObservedCapabilities(m)
+	if err != nil {
+		return nil, err
+	}
+	files, err := db.GetFilesByWorkload(workload)
+	if err != nil {
+		return nil, fmt.Errorf("observed files: %w", err)
+	}
+	processes, err := db.GetProcessesByWorkload(workload)
+	if err != nil {
+		return nil, fmt.Errorf("observed processes: %w", err)
+	}
+	if len(caps) == 0 && len(files) == 0 && len(processes) == 0 {
+		return nil, nil
+	}
+
+	baseline := &falco.Baseline{Workload: workload, PodLabels: m.PodLabels()}
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		container := falco.ContainerBaseline{
+			Name:      name,
+			Processes: forContainer(processes, name),
+			Files:     forContainer(files, name),
+		}
+		for _, capability := range forContainer(caps, name) {
+			container.Capabilities = append(container.Capabilities, "CAP_"+capability)
+		}
+		baseline.Containers = append(baseline.Containers, container)
+	}
+	return baseline, nil
+}
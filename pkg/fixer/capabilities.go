@@ -0,0 +1,96 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/falco"
+	"slices"
+	"strings"
+)
+
+// ObservedCapabilities 返回工作负载所有 Pod 在 observe 期间按容器汇总的 capabilities（不含 CAP_ 前缀），
+// observed 为 false 表示 Falco 没有观测到该工作负载的任何行为，只有指标数据时也是如此
+func ObservedCapabilities(m *Manifest) (caps map[string][]string, observed bool, err error) {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil, false, fmt.Errorf("unsupported kind %s", m.Kind())
+	}
+	observed, err = db.BehaviourObserved(workload)
+	if err != nil || !observed {
+		return nil, false, err
+	}
+	raw, err := db.GetCapsByWorkload(workload)
+	if err != nil {
+		return nil, true, err
+	}
+	caps = map[string][]string{}
+	for container, list := range raw {
+		for _, c := range list {
+			caps[container] = append(caps[container], strings.TrimPrefix(c, "CAP_"))
+		}
+	}
+	return caps, true, nil
+}
+
+// retainedCapabilities 返回容器当前拥有、但无法被观测的 capabilities（不含 CAP_ 前缀）。
+// 运行时默认授予所有 falco.UnobservableCapabilities，除非被 drop；drop 了 ALL 时只有 add 中的才算拥有
+func retainedCapabilities(c map[string]any) []string {
+	has := func(field, capability string) bool {
+		list, _ := nested(c, "securityContext", "capabilities", field).([]any)
+		return slices.ContainsFunc(list, func(v any) bool {
+			s, _ := v.(string)
+			s = strings.TrimPrefix(strings.ToUpper(s), "CAP_")
+			return s == capability || field == "drop" && s == "ALL"
+		})
+	}
+	var result []string
+	for _, capability := range falco.UnobservableCapabilities {
+		capability = strings.TrimPrefix(capability, "CAP_")
+		if has("add", capability) || !has("drop", capability) {
+			result = append(result, capability)
+		}
+	}
+	return result
+}
+
+// leastPrivilegeCapabilities 将每个容器的 capabilities 改写为 drop ALL，只添加该容器观测到的 capabilities，
+// 以及容器原本拥有、但无法被观测的 capabilities
+func leastPrivilegeCapabilities(m *Manifest, job *Job) error {
+	caps, observed, err := ObservedCapabilities(m)
+	if err != nil {
+		return fmt.Errorf("observed capabilities: %w", err)
+	}
+	if !observed {
+		job.warn("no behaviour was observed for %s/%s, capabilities were not tightened", m.Kind(), m.Name())
+		job.addContext("Falco 没有观测到该工作负载的行为，请勿根据猜测增删 capabilities。")
+		return nil
+	}
+
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		observedCaps := forContainer(caps, name)
+		retained := slices.DeleteFunc(retainedCapabilities(c), func(capability string) bool { return slices.Contains(observedCaps, capability) })
+		added := slices.Concat(observedCaps, retained)
+		capabilities := map[string]any{"drop": []any{"ALL"}}
+		if len(added) > 0 {
+			add := make([]any, 0, len(added))
+			for _, c := range added {
+				add = append(add, c)
+			}
+			capabilities["add"] = add
+		}
+		ensureMap(c, "securityContext")["capabilities"] = capabilities
+		job.pin(name, capabilities, "securityContext", "capabilities")
+		m.Modified = true
+
+		if len(added) == 0 {
+			job.addContext("observe 期间容器 %s 没有使用任何 capability，已将其 securityContext.capabilities 设置为 drop: [ALL]，请保持不变。", name)
+		} else {
+			job.addContext("已根据 observe 期间观测到的 capabilities 将容器 %s 的 securityContext.capabilities 设置为 drop: [ALL]、add: [%s]，请保持不变。", name, strings.Join(added, ", "))
+		}
+		if len(retained) > 0 {
+			job.addContext("其中 %s 的使用无法被观测，因容器原本拥有而保留，请不要删除。", strings.Join(retained, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package fixer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRetainedCapabilities(t *testing.T) {
+	all := []string{"DAC_OVERRIDE", "FSETID", "SETPCAP", "SETFCAP", "AUDIT_WRITE"}
+	tests := []struct {
+		name         string
+		capabilities map[string]any
+		want         []string
+	}{
+		{"runtime default", nil, all},
+		{"dropped individually", map[string]any{"drop": []any{"SETPCAP", "CAP_SETFCAP", "net_raw"}}, []string{"DAC_OVERRIDE", "FSETID", "AUDIT_WRITE"}},
+		{"dropped all", map[string]any{"drop": []any{"ALL"}}, nil},
+		{"added back", map[string]any{"drop": []any{"all"}, "add": []any{"DAC_OVERRIDE", "NET_BIND_SERVICE"}}, []string{"DAC_OVERRIDE"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := map[string]any{"name": "app"}
+			if tt.capabilities != nil {
+				c["securityContext"] = map[string]any{"capabilities": tt.capabilities}
+			}
+			if got := retainedCapabilities(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("retainedCapabilities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
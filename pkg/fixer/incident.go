@@ -0,0 +1,70 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+)
+
+// observedIncidents 返回工作负载在指标时间范围内按容器汇总的异常
+func observedIncidents(m *Manifest) (map[string][]db.IncidentSummary, error) {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %s", m.Kind())
+	}
+	from, _ := metricsWindow()
+	return db.GetIncidentsByWorkload(workload, from)
+}
+
+// oomLimit 返回容器因 OOM 被终止时的最大 memory limit，没有记录时返回 0
+func oomLimit(incidents []db.IncidentSummary) int64 {
+	var limit int64
+	for _, i := range incidents {
+		if i.Reason == db.IncidentOOMKilled {
+			limit = max(limit, i.MaxMemoryLimit)
+		}
+	}
+	return limit
+}
+
+// hasIncident 报告容器是否发生过某种异常
+func hasIncident(incidents []db.IncidentSummary, reason string) bool {
+	for _, i := range incidents {
+		if i.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// incidentContext 将观测期间的 OOM、崩溃重启、探针失败、CPU 限流告警和调度失败作为上下文交给 LLM
+func incidentContext(m *Manifest, job *Job) error {
+	incidents, err := observedIncidents(m)
+	if err != nil {
+		return fmt.Errorf("observed incidents: %w", err)
+	}
+	for _, i := range incidents[""] {
+		if i.Reason == db.IncidentFailedScheduling {
+			job.addContext("该工作负载的 Pod 曾 %d 次调度失败（最近一次：%s），请不要提高 resources.requests 或添加更严格的调度约束。", i.Count, i.Message)
+		}
+	}
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		for _, i := range incidents[name] {
+			switch i.Reason {
+			case db.IncidentOOMKilled:
+				if i.MaxMemoryLimit > 0 {
+					job.addContext("容器 %s 曾 %d 次因 OOM 被终止，当时的 memory limit 最高为 %dMi，memory limit 必须高于该值。", name, i.Count, i.MaxMemoryLimit>>20)
+				} else {
+					job.addContext("容器 %s 曾 %d 次因 OOM 被终止，当时没有设置 memory limit，请不要设置过低的 memory limit。", name, i.Count)
+				}
+			case db.IncidentCrashLoopBackOff:
+				job.addContext("容器 %s 曾 %d 次处于 CrashLoopBackOff（最近一次：%s），请谨慎收紧其资源和权限。", name, i.Count, i.Message)
+			case db.IncidentProbeFailure:
+				job.addContext("容器 %s 的探针曾失败 %d 次（最近一次：%s），请不要缩短探针的 initialDelaySeconds、timeoutSeconds 或 failureThreshold。", name, i.Count, i.Message)
+			case db.IncidentCPUThrottling:
+				job.addContext("容器 %s 曾 %d 次出现 CPU 限流告警，CPU limit 不应低于实际使用的峰值。", name, i.Count)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package fixer provides the iterative LLM fix loop for Kubernetes manifests
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/lint"
+	"kubefix-cli/pkg/llm"
+	"kubefix-cli/pkg/utils"
+)
+
+// Status 表示一个对象修复的最终状态
+type Status string
+
+const (
+	// StatusFixed 修复结果可解析且没有剩余诊断
+	StatusFixed Status = "fixed"
+	// StatusUnresolved 达到最大轮数后仍有剩余诊断
+	StatusUnresolved Status = "unresolved"
+	// StatusFailed 没有得到任何可解析的修复结果
+	StatusFailed Status = "failed"
+)
+
+// Round 记录一轮修复的复检结果
+type Round struct {
+	Round       int      `json:"round"`
+	ParseError  string   `json:"parseError,omitempty"`
+	Restored    []string `json:"restored,omitempty"` // LLM 修改或删除、已恢复为观测结果的字段
+	Diagnostics []string `json:"diagnostics,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// History 记录一个对象的所有修复轮次及最终状态
+type History struct {
+	Object   string   `json:"object"`
+	Context  []string `json:"context,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Rounds   []Round  `json:"rounds"`
+	Status   Status   `json:"status"`
+}
+
+// Result 是迭代修复的结果，Fixed 为最后一次可解析的修复内容
+type Result struct {
+	Fixed   []byte
+	History History
+}
+
+// checkCandidate 从 LLM 回复中提取修复后的清单，恢复 Prepare 根据观测数据写入的字段后在内存中复检，
+// restored 为被恢复的字段，parseErr 表示回复中没有有效的目标对象，err 表示复检过程出错
+func checkCandidate(reply []byte, kind, name string, pinned []pin) (fixed []byte, restored, diagnostics []string, parseErr error, err error) {
+	fixed, parseErr = llm.ExtractManifest(reply, kind, name)
+	if parseErr != nil {
+		return nil, nil, nil, parseErr, nil
+	}
+	fixed, restored, parseErr = restorePinned(fixed, pinned)
+	if parseErr != nil {
+		return nil, nil, nil, parseErr, nil
+	}
+	diagnostics, err = lint.LintContent(fixed)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error linting candidate: %w", err)
+	}
+	return fixed, restored, diagnostics, nil, nil
+}
+
+// Run 对一个对象执行迭代修复：每轮修复结果中被 LLM 修改或删除的、Prepare 根据观测数据写入的字段会被恢复，
+// 之后在内存中复检，若仍有诊断或无法解析，则将其作为新一轮对话反馈给 LLM，最多 maxRounds 轮
+func Run(provider llm.LLMProvider, job Job, maxRounds int) Result {
+	if maxRounds < 1 {
+		maxRounds = 1
+	}
+	result := Result{History: History{Object: job.Object, Context: job.Context, Warnings: job.Warnings, Status: StatusFailed}}
+
+	resources, err := utils.ParseYAMLContent(job.Resource)
+	if err == nil && len(resources) != 1 {
+		err = fmt.Errorf("expected one object, found %d", len(resources))
+	}
+	if err != nil {
+		result.History.Rounds = append(result.History.Rounds, Round{Error: fmt.Sprintf("cannot determine the object to fix: %v", err)})
+		return result
+	}
+	kind, name := resources[0].GetKind(), resources[0].GetName()
+
+	conv := llm.NewFixConversation(provider, job.Resource, job.Lint, job.Context)
+
+	var (
+		diagnostics []string
+		parseErr    error
+	)
+	for i := 1; i <= maxRounds; i++ {
+		round := Round{Round: i}
+
+		var reply []byte
+		if i == 1 {
+			reply, err = conv.Start()
+		} else {
+			reply, err = conv.FollowUp(diagnostics, parseErr)
+		}
+		if err != nil {
+			round.Error = err.Error()
+			result.History.Rounds = append(result.History.Rounds, round)
+			break
+		}
+
+		var (
+			candidate []byte
+			lintErr   error
+		)
+		candidate, round.Restored, diagnostics, parseErr, lintErr = checkCandidate(reply, kind, name, job.pinned)
+		if parseErr != nil {
+			round.ParseError = parseErr.Error()
+		}
+		round.Diagnostics = diagnostics
+		if lintErr != nil {
+			round.Error = lintErr.Error()
+			result.History.Rounds = append(result.History.Rounds, round)
+			break
+		}
+		result.History.Rounds = append(result.History.Rounds, round)
+
+		if parseErr != nil {
+			continue
+		}
+		result.Fixed = candidate
+		if len(diagnostics) == 0 {
+			result.History.Status = StatusFixed
+			return result
+		}
+		result.History.Status = StatusUnresolved
+	}
+	return result
+}
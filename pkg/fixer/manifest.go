@@ -0,0 +1,246 @@
+package fixer
+
+import (
+	"bytes"
+	"fmt"
+	"kubefix-cli/pkg/model"
+	"maps"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest 是一个可修改的 Kubernetes 对象，Modified 记录是否被确定性修复改动过。
+// 修复步骤修改 Object，序列化时将改动合并回原始文档，保留原有的键顺序和注释
+type Manifest struct {
+	Object   map[string]any
+	Modified bool
+
+	doc *yaml.Node
+}
+
+// ParseManifest 解析单个对象的 YAML 清单
+func ParseManifest(content []byte) (*Manifest, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	var obj map[string]any
+	if err := doc.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("empty manifest")
+	}
+	return &Manifest{Object: obj, doc: &doc}, nil
+}
+
+// Bytes 将对象重新序列化为 YAML，未改动的部分保持原样
+func (m *Manifest) Bytes() ([]byte, error) {
+	var out any = m.Object
+	if m.doc != nil && len(m.doc.Content) == 1 {
+		if err := mergeNode(m.doc.Content[0], m.Object); err != nil {
+			return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+		}
+		out = m.doc
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(out); err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeNode 将 value 合并到原始文档的节点中：已有的键保持原来的顺序，删除的键被移除，
+// 新增的键按字母顺序追加在后面；值未变的标量保持原有的写法，被替换的节点保留其注释
+func mergeNode(node *yaml.Node, value any) error {
+	switch v := value.(type) {
+	case map[string]any:
+		if node.Kind == yaml.MappingNode {
+			var content []*yaml.Node
+			seen := map[string]bool{}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				child, ok := v[key]
+				if !ok || seen[key] {
+					continue
+				}
+				seen[key] = true
+				if err := mergeNode(node.Content[i+1], child); err != nil {
+					return err
+				}
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				if seen[key] {
+					continue
+				}
+				keyNode := &yaml.Node{}
+				keyNode.SetString(key)
+				valueNode := &yaml.Node{}
+				if err := valueNode.Encode(v[key]); err != nil {
+					return err
+				}
+				content = append(content, keyNode, valueNode)
+			}
+			node.Content = content
+			return nil
+		}
+	case []any:
+		if node.Kind == yaml.SequenceNode {
+			content := node.Content[:min(len(node.Content), len(v))]
+			for i, item := range v {
+				if i < len(content) {
+					if err := mergeNode(content[i], item); err != nil {
+						return err
+					}
+					continue
+				}
+				itemNode := &yaml.Node{}
+				if err := itemNode.Encode(item); err != nil {
+					return err
+				}
+				content = append(content, itemNode)
+			}
+			node.Content = content
+			return nil
+		}
+	default:
+		var old any
+		if node.Kind == yaml.ScalarNode && node.Decode(&old) == nil && reflect.DeepEqual(old, value) {
+			return nil
+		}
+	}
+
+	var replacement yaml.Node
+	if err := replacement.Encode(value); err != nil {
+		return err
+	}
+	replacement.HeadComment, replacement.LineComment, replacement.FootComment = node.HeadComment, node.LineComment, node.FootComment
+	*node = replacement
+	return nil
+}
+
+func (m *Manifest) Kind() string {
+	kind, _ := m.Object["kind"].(string)
+	return kind
+}
+
+func (m *Manifest) Name() string {
+	name, _ := nested(m.Object, "metadata", "name").(string)
+	return name
+}
+
+func (m *Manifest) Namespace() string {
+	namespace, _ := nested(m.Object, "metadata", "namespace").(string)
+	return namespace
+}
+
+// Workload 返回清单对应的工作负载标识，与 observe 期间记录的工作负载一致
+func (m *Manifest) Workload() (model.Workload, bool) {
+	switch m.Kind() {
+	case "Pod", "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job", "CronJob":
+		return model.Workload{Namespace: m.Namespace(), Kind: m.Kind(), Name: m.Name()}, true
+	}
+	return model.Workload{}, false
+}
+
+// PodSpec 返回工作负载的 Pod 模板 spec，非工作负载返回 nil
+func (m *Manifest) PodSpec() map[string]any {
+	var spec any
+	switch m.Kind() {
+	case "Pod":
+		spec = nested(m.Object, "spec")
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		spec = nested(m.Object, "spec", "template", "spec")
+	case "CronJob":
+		spec = nested(m.Object, "spec", "jobTemplate", "spec", "template", "spec")
+	}
+	podSpec, _ := spec.(map[string]any)
+	return podSpec
+}
+
+// PodLabels 返回工作负载创建的 Pod 所带的标签
+func (m *Manifest) PodLabels() map[string]string {
+	var labels any
+	switch m.Kind() {
+	case "Pod":
+		labels = nested(m.Object, "metadata", "labels")
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		labels = nested(m.Object, "spec", "template", "metadata", "labels")
+	case "CronJob":
+		labels = nested(m.Object, "spec", "jobTemplate", "spec", "template", "metadata", "labels")
+	}
+	result := map[string]string{}
+	if l, ok := labels.(map[string]any); ok {
+		for k, v := range l {
+			if s, ok := v.(string); ok {
+				result[k] = s
+			}
+		}
+	}
+	return result
+}
+
+// Containers 返回 Pod 模板中的容器，includeInit 为 true 时包含 init 容器
+func (m *Manifest) Containers(includeInit bool) []map[string]any {
+	podSpec := m.PodSpec()
+	if podSpec == nil {
+		return nil
+	}
+	fields := []string{"containers"}
+	if includeInit {
+		fields = append(fields, "initContainers")
+	}
+	var containers []map[string]any
+	for _, field := range fields {
+		list, _ := podSpec[field].([]any)
+		for _, item := range list {
+			if c, ok := item.(map[string]any); ok {
+				containers = append(containers, c)
+			}
+		}
+	}
+	return containers
+}
+
+// forContainer 从按容器汇总的观测数据中取出某个容器的数据，
+// 未区分容器的旧数据（键为空字符串）对所有容器都适用
+func forContainer(observed map[string][]string, container string) []string {
+	values := slices.Concat(observed[container], observed[""])
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+// nested 按路径读取嵌套的 map 字段
+func nested(obj map[string]any, path ...string) any {
+	var cur any = obj
+	for _, key := range path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+	return cur
+}
+
+// ensureMap 按路径获取嵌套的 map 字段，不存在时创建
+func ensureMap(obj map[string]any, path ...string) map[string]any {
+	cur := obj
+	for _, key := range path {
+		next, ok := cur[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			cur[key] = next
+		}
+		cur = next
+	}
+	return cur
+}
@@ -0,0 +1,15 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+)
+
+// ObservedConnections 返回工作负载所有 Pod 在 observe 期间的网络连接
+func ObservedConnections(m *Manifest) ([]db.Connection, error) {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %s", m.Kind())
+	}
+	return db.GetConnectionsByWorkload(workload)
+}
@@ -0,0 +1,116 @@
+package fixer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pin 是 Prepare 根据观测数据写入清单、LLM 修复后必须保留的字段。
+// Container 为空表示 Pod spec 中的字段；Key 非空时 Path 指向一个列表，Value 是其中以 Key 字段标识的元素
+type pin struct {
+	Container string
+	Path      []string
+	Key       string
+	Value     any
+}
+
+func (p pin) String() string {
+	field := strings.Join(p.Path, ".")
+	if p.Key != "" {
+		field = fmt.Sprintf("%s[%s=%v]", field, p.Key, asMap(p.Value)[p.Key])
+	}
+	if p.Container == "" {
+		return "spec." + field
+	}
+	return fmt.Sprintf("container %s %s", p.Container, field)
+}
+
+// pin 记录 Prepare 写入的字段，container 为空表示 Pod spec 中的字段
+func (job *Job) pin(container string, value any, path ...string) {
+	job.pinned = append(job.pinned, pin{Container: container, Path: path, Value: normalize(value)})
+}
+
+// pinItem 记录 Prepare 向 path 处的列表写入的元素，元素以 key 字段标识
+func (job *Job) pinItem(container string, key string, item map[string]any, path ...string) {
+	job.pinned = append(job.pinned, pin{Container: container, Path: path, Key: key, Value: normalize(item)})
+}
+
+// normalize 将值转换为从 YAML 解析得到的形式，使其可以与 LLM 修复结果中的值直接比较
+func normalize(v any) any {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var result any
+	if err := yaml.Unmarshal(out, &result); err != nil {
+		return v
+	}
+	return result
+}
+
+// restorePinned 将 LLM 修复结果中被修改或删除的固定字段恢复为 Prepare 写入的值，
+// 返回恢复后的清单和被恢复的字段。修复结果删除了固定字段所在的容器时返回错误
+func restorePinned(fixed []byte, pinned []pin) ([]byte, []string, error) {
+	if len(pinned) == 0 {
+		return fixed, nil, nil
+	}
+	m, err := ParseManifest(fixed)
+	if err != nil {
+		return nil, nil, err
+	}
+	containers := map[string]map[string]any{}
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		containers[name] = c
+	}
+
+	var restored []string
+	for _, p := range pinned {
+		target := m.PodSpec()
+		if p.Container != "" {
+			target = containers[p.Container]
+		}
+		if target == nil {
+			return nil, nil, fmt.Errorf("container %s was removed, keep it and its %s", p.Container, strings.Join(p.Path, "."))
+		}
+		parent := ensureMap(target, p.Path[:len(p.Path)-1]...)
+		field := p.Path[len(p.Path)-1]
+		if p.Key == "" {
+			if !reflect.DeepEqual(parent[field], p.Value) {
+				parent[field] = p.Value
+				restored = append(restored, p.String())
+			}
+			continue
+		}
+
+		list, _ := parent[field].([]any)
+		id := asMap(p.Value)[p.Key]
+		i := -1
+		for j, item := range list {
+			if asMap(item)[p.Key] == id {
+				i = j
+				break
+			}
+		}
+		switch {
+		case i < 0:
+			parent[field] = append(list, p.Value)
+		case !reflect.DeepEqual(list[i], p.Value):
+			list[i] = p.Value
+		default:
+			continue
+		}
+		restored = append(restored, p.String())
+	}
+	if len(restored) == 0 {
+		return fixed, nil, nil
+	}
+	out, err := m.Bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, restored, nil
+}
@@ -0,0 +1,106 @@
+package fixer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const pinnedManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      securityContext:
+        fsGroup: 1000
+      containers:
+      - name: web
+        image: web
+        securityContext:
+          readOnlyRootFilesystem: true
+          runAsUser: 1000
+        volumeMounts:
+        - name: tmp
+          mountPath: /tmp
+      volumes:
+      - name: tmp
+        emptyDir: {}
+`
+
+func TestRestorePinned(t *testing.T) {
+	job := &Job{}
+	job.pin("web", true, "securityContext", "readOnlyRootFilesystem")
+	job.pin("web", int64(1000), "securityContext", "runAsUser")
+	job.pin("web", map[string]any{"limits": map[string]any{"memory": "256Mi"}}, "resources")
+	job.pin("", int64(1000), "securityContext", "fsGroup")
+	job.pinItem("web", "mountPath", map[string]any{"name": "tmp", "mountPath": "/tmp"}, "volumeMounts")
+	job.pinItem("web", "mountPath", map[string]any{"name": "cache", "mountPath": "/var/cache/nginx"}, "volumeMounts")
+	job.pinItem("", "name", map[string]any{"name": "tmp", "emptyDir": map[string]any{}}, "volumes")
+
+	tests := []struct {
+		name     string
+		fixed    string
+		restored []string
+	}{
+		{"unchanged", pinnedManifest, []string{
+			"container web resources",
+			"container web volumeMounts[mountPath=/var/cache/nginx]",
+		}},
+		{"changed and removed", strings.NewReplacer(
+			"readOnlyRootFilesystem: true", "readOnlyRootFilesystem: false",
+			"runAsUser: 1000", "runAsUser: 0",
+			"        fsGroup: 1000\n", "        runAsNonRoot: true\n",
+			"        volumeMounts:\n        - name: tmp\n          mountPath: /tmp\n", "",
+		).Replace(pinnedManifest), []string{
+			"container web securityContext.readOnlyRootFilesystem",
+			"container web securityContext.runAsUser",
+			"container web resources",
+			"spec.securityContext.fsGroup",
+			"container web volumeMounts[mountPath=/tmp]",
+			"container web volumeMounts[mountPath=/var/cache/nginx]",
+		}},
+		{"replaced item", strings.Replace(pinnedManifest, "emptyDir: {}", "hostPath:\n          path: /tmp", 1), []string{
+			"container web resources",
+			"container web volumeMounts[mountPath=/var/cache/nginx]",
+			"spec.volumes[name=tmp]",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, restored, err := restorePinned([]byte(tt.fixed), job.pinned)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(restored, tt.restored) {
+				t.Errorf("restored = %q, want %q", restored, tt.restored)
+			}
+
+			// 恢复后的清单与 Prepare 写入的一致，再次恢复不应有变化
+			m, err := ParseManifest(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			web := m.Containers(false)[0]
+			if got := nested(web, "securityContext", "runAsUser"); got != 1000 {
+				t.Errorf("runAsUser = %v, want 1000", got)
+			}
+			if got := nested(web, "resources", "limits", "memory"); got != "256Mi" {
+				t.Errorf("memory limit = %v, want 256Mi", got)
+			}
+			if _, again, err := restorePinned(out, job.pinned); err != nil || len(again) > 0 {
+				t.Errorf("restoring again = %q, %v, want nothing", again, err)
+			}
+		})
+	}
+}
+
+func TestRestorePinnedRemovedContainer(t *testing.T) {
+	job := &Job{}
+	job.pin("sidecar", true, "securityContext", "readOnlyRootFilesystem")
+
+	if _, _, err := restorePinned([]byte(pinnedManifest), job.pinned); err == nil {
+		t.Error("restorePinned() succeeded for a removed container")
+	}
+}
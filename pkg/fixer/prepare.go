@@ -0,0 +1,120 @@
+package fixer
+
+import (
+	"errors"
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/coverage"
+	"kubefix-cli/pkg/db"
+)
+
+// Job 是一个待修复的对象，Context 为根据观测数据生成的说明，会附加到提示词中，
+// Warnings 记录因缺少观测数据等原因而未做处理的地方
+type Job struct {
+	Object   string
+	Resource []byte
+	Lint     []byte
+	Context  []string
+	Warnings []string
+
+	refuseTightening bool  // 观测未稳定且 coverage.fixPolicy 为 refuse
+	pinned           []pin // 根据观测数据写入、LLM 修复后会被恢复的字段
+}
+
+// step 根据观测数据对清单做确定性修改，或向 job 补充上下文
+type step func(m *Manifest, job *Job) error
+
+var steps = []step{
+	incidentContext,
+	requireStable(recommendResources),
+	requireStable(leastPrivilegeCapabilities),
+	requireStable(readOnlyRootFilesystem),
+	requireStable(runAsObservedUser),
+	generateProbes,
+	processContext,
+}
+
+// requireStable 包装根据观测数据收紧清单的步骤，观测未稳定且策略为 refuse 时跳过
+func requireStable(s step) step {
+	return func(m *Manifest, job *Job) error {
+		if job.refuseTightening {
+			return nil
+		}
+		return s(m, job)
+	}
+}
+
+// checkCoverage 检查工作负载的观测是否已经稳定，未稳定时按 coverage.fixPolicy 给出警告或禁止收紧
+func checkCoverage(m *Manifest, job *Job) error {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil
+	}
+	report, err := coverage.Status(workload)
+	if err != nil {
+		return fmt.Errorf("observation coverage: %w", err)
+	}
+	if report.Stable {
+		return nil
+	}
+	if !report.Observed {
+		// 完全没有观测数据的情况由各步骤分别处理；有观测数据却没有覆盖记录时（例如旧版本或中途中断的观测）
+		// 无法判断是否稳定，按未稳定处理
+		pods, err := db.ObservedPods(workload)
+		if err != nil {
+			return fmt.Errorf("observed pods: %w", err)
+		}
+		if len(pods) == 0 {
+			return nil
+		}
+		report.Reason = "observations were recorded without coverage tracking"
+	}
+	if conf.Coverage.FixPolicy == "refuse" {
+		job.refuseTightening = true
+		job.warn("observations of %s/%s are not stable yet (%s), it was not tightened from observed behaviour", m.Kind(), m.Name(), report.Reason)
+		job.addContext("该工作负载的观测数据尚未稳定，请勿根据观测数据收紧 capabilities、文件系统、运行用户或资源配置。")
+		return nil
+	}
+	job.warn("observations of %s/%s are not stable yet (%s), tightening may break behaviour that was not observed", m.Kind(), m.Name(), report.Reason)
+	job.addContext("该工作负载的观测数据尚未稳定（%s），可能有尚未观测到的行为，收紧时请保守。", report.Reason)
+	return nil
+}
+
+// Prepare 在调用 LLM 之前依次执行所有确定性修复步骤，
+// 单个步骤失败不影响其余步骤，所有错误合并后返回
+func Prepare(job *Job) error {
+	m, err := ParseManifest(job.Resource)
+	if err != nil {
+		return err
+	}
+	if m.PodSpec() == nil {
+		return nil
+	}
+
+	var errs []error
+	if err := checkCoverage(m, job); err != nil {
+		errs = append(errs, err)
+	}
+	for _, s := range steps {
+		if err := s(m, job); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if m.Modified {
+		out, err := m.Bytes()
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		job.Resource = out
+	}
+	return errors.Join(errs...)
+}
+
+func (job *Job) addContext(format string, args ...any) {
+	job.Context = append(job.Context, fmt.Sprintf(format, args...))
+}
+
+func (job *Job) warn(format string, args ...any) {
+	job.Warnings = append(job.Warnings, fmt.Sprintf(format, args...))
+}
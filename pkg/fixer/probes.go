@@ -0,0 +1,255 @@
+package fixer
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ProbeCluster 提供生成探针时需要的集群信息，client.PodProber 是其实现
+type ProbeCluster interface {
+	Services(ctx context.Context, namespace string) ([]corev1.Service, error)
+	ProbeHTTP(ctx context.Context, namespace, pod string, port int, path string) (int, error)
+}
+
+// Cluster 为 nil 时不检查 Service，只生成 TCP 探针
+var Cluster ProbeCluster
+
+// probePaths 是依次尝试的 HTTP 健康检查路径
+var probePaths = []string{"/healthz", "/health", "/livez", "/readyz", "/ready", "/status", "/"}
+
+// maxProbePods 是尝试 HTTP 探针的 Pod 数上限，观测过的 Pod 可能已经不存在
+const maxProbePods = 3
+
+// listeningPort 是容器监听的端口
+type listeningPort struct {
+	Port     int
+	Protocol string
+}
+
+func (p listeningPort) String() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+func parseListeningPorts(values []string) []listeningPort {
+	var ports []listeningPort
+	for _, v := range values {
+		port, protocol, _ := strings.Cut(v, "/")
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 {
+			continue
+		}
+		ports = append(ports, listeningPort{Port: n, Protocol: protocol})
+	}
+	return ports
+}
+
+// declaredPorts 返回容器声明的 containerPorts，以及端口名到端口号的映射
+func declaredPorts(c map[string]any) ([]listeningPort, map[string]int) {
+	var ports []listeningPort
+	names := map[string]int{}
+	list, _ := c["ports"].([]any)
+	for _, item := range list {
+		p := asMap(item)
+		n, ok := p["containerPort"].(int)
+		if !ok {
+			continue
+		}
+		protocol, _ := p["protocol"].(string)
+		if protocol == "" {
+			protocol = "TCP"
+		}
+		ports = append(ports, listeningPort{Port: n, Protocol: protocol})
+		if name, _ := p["name"].(string); name != "" {
+			names[name] = n
+		}
+	}
+	return ports, names
+}
+
+// serviceTargets 返回选中工作负载 Pod 的 Service 指向的容器端口号，命名的 targetPort 按 names 解析
+func serviceTargets(services []corev1.Service, labels map[string]string, names map[string]int) []int {
+	var targets []int
+	for _, s := range services {
+		if len(s.Spec.Selector) == 0 {
+			continue
+		}
+		selected := true
+		for k, v := range s.Spec.Selector {
+			if labels[k] != v {
+				selected = false
+				break
+			}
+		}
+		if !selected {
+			continue
+		}
+		for _, sp := range s.Spec.Ports {
+			port := int(sp.TargetPort.IntVal)
+			if sp.TargetPort.StrVal != "" {
+				port = names[sp.TargetPort.StrVal]
+			} else if port == 0 {
+				port = int(sp.Port)
+			}
+			if port > 0 && !slices.Contains(targets, port) {
+				targets = append(targets, port)
+			}
+		}
+	}
+	return targets
+}
+
+// probePort 选择探测的 TCP 端口：优先 Service 指向的端口，其次声明的端口，最后是端口号最小的监听端口
+func probePort(observed, declared []listeningPort, targets []int) (int, bool) {
+	var tcp []int
+	for _, p := range observed {
+		if p.Protocol == "TCP" {
+			tcp = append(tcp, p.Port)
+		}
+	}
+	slices.Sort(tcp)
+	for _, preferred := range []func(int) bool{
+		func(port int) bool { return slices.Contains(targets, port) },
+		func(port int) bool { return slices.Contains(declared, listeningPort{port, "TCP"}) },
+		func(int) bool { return true },
+	} {
+		for _, port := range tcp {
+			if preferred(port) {
+				return port, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// httpProbePath 在观测过的 Pod 上依次尝试常见的健康检查路径，返回第一个返回 2xx 或 3xx 的路径
+func httpProbePath(namespace string, pods []string, port int) (string, bool) {
+	if Cluster == nil {
+		return "", false
+	}
+	for _, pod := range pods[:min(len(pods), maxProbePods)] {
+		for _, path := range probePaths {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			status, err := Cluster.ProbeHTTP(ctx, namespace, pod, port, path)
+			cancel()
+			if err != nil {
+				// Pod 或端口不可达，换下一个 Pod
+				break
+			}
+			if status >= 200 && status < 400 {
+				return path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// generateProbes 根据 observe 期间容器实际监听的端口为缺少探针的容器生成 liveness 和 readiness 探针，
+// 能通过 HTTP 健康检查的端口生成 HTTP 探针，否则生成 TCP 探针。未声明的监听端口和未监听的声明端口会被报告
+func generateProbes(m *Manifest, job *Job) error {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil
+	}
+	pods, err := db.ObservedPods(workload)
+	if err != nil {
+		return fmt.Errorf("observed pods: %w", err)
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+	listening, err := db.GetListeningPortsByWorkload(workload)
+	if err != nil {
+		return fmt.Errorf("observed listening ports: %w", err)
+	}
+	incidents, err := observedIncidents(m)
+	if err != nil {
+		return fmt.Errorf("observed incidents: %w", err)
+	}
+	var services []corev1.Service
+	if Cluster != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		services, err = Cluster.Services(ctx, workload.Namespace)
+		cancel()
+		if err != nil {
+			job.warn("services were not checked: %v", err)
+		}
+	}
+	addProbes(m, job, pods, listening, incidents, services)
+	return nil
+}
+
+// addProbes 为缺少探针的容器添加探针。pods 是观测过的 Pod，listening 和 incidents 是按容器汇总的监听端口和异常，
+// services 是工作负载所在命名空间的 Service
+func addProbes(m *Manifest, job *Job, pods []string, listening map[string][]string, incidents map[string][]db.IncidentSummary, services []corev1.Service) {
+	namespace := m.Namespace()
+	for _, c := range m.Containers(false) {
+		name, _ := c["name"].(string)
+		observed := parseListeningPorts(forContainer(listening, name))
+		declared, names := declaredPorts(c)
+		var undeclared, unused []string
+		for _, p := range observed {
+			if !slices.Contains(declared, p) {
+				undeclared = append(undeclared, p.String())
+			}
+		}
+		for _, p := range declared {
+			if len(observed) > 0 && !slices.Contains(observed, p) {
+				unused = append(unused, p.String())
+			}
+		}
+		if len(undeclared) > 0 {
+			job.warn("container %s listens on undeclared ports %s", name, strings.Join(undeclared, ", "))
+			job.addContext("observe 期间容器 %s 监听了未在 containerPorts 中声明的端口 %s。", name, strings.Join(undeclared, ", "))
+		}
+		if len(unused) > 0 {
+			job.warn("container %s declares ports %s that were never listened on", name, strings.Join(unused, ", "))
+		}
+
+		_, hasLiveness := c["livenessProbe"]
+		_, hasReadiness := c["readinessProbe"]
+		if hasLiveness && hasReadiness {
+			continue
+		}
+		port, ok := probePort(observed, declared, serviceTargets(services, m.PodLabels(), names))
+		if !ok {
+			job.addContext("observe 期间没有观测到容器 %s 监听 TCP 端口，请不要猜测探针的端口和路径。", name)
+			continue
+		}
+		handler := map[string]any{"tcpSocket": map[string]any{"port": port}}
+		description := fmt.Sprintf("TCP 端口 %d", port)
+		if path, ok := httpProbePath(namespace, pods, port); ok {
+			handler = map[string]any{"httpGet": map[string]any{"path": path, "port": port}}
+			description = fmt.Sprintf("HTTP GET %d%s", port, path)
+		}
+		// 探针曾经失败过的容器启动较慢或偶尔无响应，放宽探针避免被反复重启
+		liveness, readiness := probe(handler, 10, 10, 3), probe(handler, 5, 5, 3)
+		if hasIncident(incidents[name], db.IncidentProbeFailure) {
+			liveness, readiness = probe(handler, 30, 15, 5), probe(handler, 10, 10, 5)
+		}
+		if !hasLiveness {
+			c["livenessProbe"] = liveness
+			job.pin(name, liveness, "livenessProbe")
+		}
+		if !hasReadiness {
+			c["readinessProbe"] = readiness
+			job.pin(name, readiness, "readinessProbe")
+		}
+		m.Modified = true
+		job.addContext("已根据 observe 期间容器 %s 实际监听的端口添加了探测 %s 的探针，请保持不变。", name, description)
+	}
+}
+
+func probe(handler map[string]any, initialDelay, period, failureThreshold int) map[string]any {
+	p := map[string]any{"initialDelaySeconds": initialDelay, "periodSeconds": period, "failureThreshold": failureThreshold}
+	for k, v := range handler {
+		p[k] = v
+	}
+	return p
+}
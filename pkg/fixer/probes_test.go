@@ -0,0 +1,204 @@
+package fixer
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"reflect"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// fakeCluster 返回预设的 Service 和 HTTP 状态码。
+// HTTP 的键形如 pod:port/path，未预设的请求返回错误，相当于端口不可达
+type fakeCluster struct {
+	services []corev1.Service
+	http     map[string]int
+}
+
+func (f *fakeCluster) Services(ctx context.Context, namespace string) ([]corev1.Service, error) {
+	var result []corev1.Service
+	for _, s := range f.services {
+		if s.Namespace == namespace {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeCluster) ProbeHTTP(ctx context.Context, namespace, pod string, port int, path string) (int, error) {
+	if status, ok := f.http[fmt.Sprintf("%s:%d%s", pod, port, path)]; ok {
+		return status, nil
+	}
+	return 0, fmt.Errorf("%s:%d unreachable", pod, port)
+}
+
+func service(namespace string, selector map[string]string, ports ...corev1.ServicePort) corev1.Service {
+	return corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "svc"},
+		Spec:       corev1.ServiceSpec{Selector: selector, Ports: ports},
+	}
+}
+
+func TestServiceTargets(t *testing.T) {
+	labels := map[string]string{"app": "web", "tier": "frontend"}
+	names := map[string]int{"http": 8080, "metrics": 9090}
+	services := []corev1.Service{
+		service("default", map[string]string{"app": "web"},
+			corev1.ServicePort{Port: 80, TargetPort: intstr.FromString("http")},
+			corev1.ServicePort{Port: 81, TargetPort: intstr.FromString("unknown")},
+			corev1.ServicePort{Port: 443, TargetPort: intstr.FromInt32(8443)},
+			corev1.ServicePort{Port: 9000}),
+		service("default", map[string]string{"app": "web", "tier": "frontend"},
+			corev1.ServicePort{Port: 90, TargetPort: intstr.FromString("metrics")},
+			corev1.ServicePort{Port: 91, TargetPort: intstr.FromString("http")}),
+		service("default", map[string]string{"app": "db"}, corev1.ServicePort{Port: 5432}),
+		service("default", nil, corev1.ServicePort{Port: 6443}),
+	}
+
+	got := serviceTargets(services, labels, names)
+	if want := []int{8080, 8443, 9000, 9090}; !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceTargets() = %v, want %v", got, want)
+	}
+}
+
+func TestProbePort(t *testing.T) {
+	tcp := func(ports ...int) []listeningPort {
+		var result []listeningPort
+		for _, p := range ports {
+			result = append(result, listeningPort{Port: p, Protocol: "TCP"})
+		}
+		return result
+	}
+	tests := []struct {
+		name     string
+		observed []listeningPort
+		declared []listeningPort
+		targets  []int
+		port     int
+		ok       bool
+	}{
+		{"prefers service target", tcp(8080, 9090, 3000), tcp(8080), []int{9090}, 9090, true},
+		{"then declared port", tcp(8080, 9090, 3000), tcp(9090), nil, 9090, true},
+		{"then lowest port", tcp(8080, 9090, 3000), nil, nil, 3000, true},
+		{"ignores targets that are not listened on", tcp(8080), nil, []int{9090}, 8080, true},
+		{"ignores udp", []listeningPort{{53, "UDP"}, {8080, "TCP"}}, nil, []int{53}, 8080, true},
+		{"nothing listening", []listeningPort{{53, "UDP"}}, nil, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, ok := probePort(tt.observed, tt.declared, tt.targets)
+			if port != tt.port || ok != tt.ok {
+				t.Errorf("probePort() = %d, %v, want %d, %v", port, ok, tt.port, tt.ok)
+			}
+		})
+	}
+}
+
+const probeManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: web
+        ports:
+        - name: http
+          containerPort: 8080
+      - name: sidecar
+        image: sidecar
+      - name: worker
+        image: worker
+      - name: probed
+        image: probed
+        livenessProbe:
+          exec:
+            command: ["true"]
+        readinessProbe:
+          exec:
+            command: ["true"]
+`
+
+func TestAddProbes(t *testing.T) {
+	m, err := ParseManifest([]byte(probeManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第一个 Pod 已不存在，第二个 Pod 的 /healthz 不存在但 /health 可用
+	http := map[string]int{"web-2:8080/healthz": 404, "web-2:8080/health": 200}
+	// sidecar 的端口可达但没有 HTTP 健康检查路径
+	for _, path := range probePaths {
+		http["web-2:15000"+path] = 404
+	}
+	Cluster = &fakeCluster{
+		services: []corev1.Service{service("shop", map[string]string{"app": "web"}, corev1.ServicePort{Port: 80, TargetPort: intstr.FromString("http")})},
+		http:     http,
+	}
+	t.Cleanup(func() { Cluster = nil })
+
+	listening := map[string][]string{
+		// 7000 端口号更小，但 Service 指向命名端口 http
+		"web":     {"8080/TCP", "7000/TCP"},
+		"sidecar": {"15000/TCP"},
+		"worker":  {"53/UDP"},
+		"probed":  {"8081/TCP"},
+	}
+	incidents := map[string][]db.IncidentSummary{"sidecar": {{Container: "sidecar", Reason: db.IncidentProbeFailure, Count: 2}}}
+	services, _ := Cluster.Services(context.Background(), "shop")
+	job := &Job{}
+	addProbes(m, job, []string{"web-1", "web-2"}, listening, incidents, services)
+
+	containers := m.Containers(false)
+	web, sidecar, worker, probed := containers[0], containers[1], containers[2], containers[3]
+	if want := probe(map[string]any{"httpGet": map[string]any{"path": "/health", "port": 8080}}, 10, 10, 3); !reflect.DeepEqual(web["livenessProbe"], want) {
+		t.Errorf("web livenessProbe = %v, want %v", web["livenessProbe"], want)
+	}
+	if want := probe(map[string]any{"httpGet": map[string]any{"path": "/health", "port": 8080}}, 5, 5, 3); !reflect.DeepEqual(web["readinessProbe"], want) {
+		t.Errorf("web readinessProbe = %v, want %v", web["readinessProbe"], want)
+	}
+	// 探针失败过的容器使用更宽松的探针
+	if want := probe(map[string]any{"tcpSocket": map[string]any{"port": 15000}}, 30, 15, 5); !reflect.DeepEqual(sidecar["livenessProbe"], want) {
+		t.Errorf("sidecar livenessProbe = %v, want %v", sidecar["livenessProbe"], want)
+	}
+	if _, ok := worker["livenessProbe"]; ok {
+		t.Errorf("worker without TCP ports got a probe: %v", worker["livenessProbe"])
+	}
+	if command := nested(probed, "livenessProbe", "exec", "command"); !reflect.DeepEqual(command, []any{"true"}) {
+		t.Errorf("existing probe of container probed was replaced: %v", probed["livenessProbe"])
+	}
+	if !m.Modified {
+		t.Error("manifest not marked as modified")
+	}
+
+	if !slices.Contains(job.Warnings, "container web listens on undeclared ports 7000/TCP") {
+		t.Errorf("warnings = %q, want the undeclared port of web", job.Warnings)
+	}
+	if !slices.Contains(job.Context, "observe 期间没有观测到容器 worker 监听 TCP 端口，请不要猜测探针的端口和路径。") {
+		t.Errorf("context = %q, want a note about worker", job.Context)
+	}
+}
+
+func TestAddProbesWithoutCluster(t *testing.T) {
+	m, err := ParseManifest([]byte(probeManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{}
+	addProbes(m, job, []string{"web-1"}, map[string][]string{"web": {"8080/TCP"}}, nil, nil)
+
+	web := m.Containers(false)[0]
+	if want := probe(map[string]any{"tcpSocket": map[string]any{"port": 8080}}, 10, 10, 3); !reflect.DeepEqual(web["livenessProbe"], want) {
+		t.Errorf("web livenessProbe = %v, want %v", web["livenessProbe"], want)
+	}
+}
@@ -0,0 +1,170 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"path"
+	"slices"
+	"strings"
+)
+
+var (
+	shells          = []string{"sh", "bash", "ash", "dash", "zsh", "ksh", "csh", "tcsh", "fish", "busybox"}
+	packageManagers = []string{"apt", "apt-get", "aptitude", "dpkg", "yum", "dnf", "microdnf", "rpm", "zypper", "apk", "pacman", "pip", "pip3", "npm", "yarn", "gem"}
+	networkTools    = []string{"curl", "wget", "nc", "ncat", "netcat", "socat", "nmap", "telnet", "ssh", "scp", "sftp", "ftp", "dig", "nslookup", "host", "ping", "tcpdump"}
+)
+
+// ProcessProfile 是一个容器在 observe 期间执行过的程序及其分类，不包括 kubelet 执行的 exec 探针和生命周期钩子命令。
+// EntrypointOnly 表示容器只执行过一个程序，且它不是 shell、包管理器或网络工具，探针和钩子也没有用到这些工具；
+// 只有容器在 observe 期间启动过时才能看到其入口程序，这个结论才成立
+type ProcessProfile struct {
+	Container       string
+	Binaries        []string
+	Probes          []string // 被排除的探针和钩子命令执行的程序
+	EntrypointOnly  bool
+	Shells          []string
+	PackageManagers []string
+	NetworkTools    []string
+}
+
+// Suspicious 报告容器是否执行过 shell、包管理器或网络工具
+func (p ProcessProfile) Suspicious() bool {
+	return len(p.Shells)+len(p.PackageManagers)+len(p.NetworkTools) > 0
+}
+
+// Verdict 返回对容器的简短结论
+func (p ProcessProfile) Verdict() string {
+	var findings []string
+	if len(p.Shells) > 0 {
+		findings = append(findings, "spawns shells: "+strings.Join(p.Shells, ", "))
+	}
+	if len(p.PackageManagers) > 0 {
+		findings = append(findings, "runs package managers: "+strings.Join(p.PackageManagers, ", "))
+	}
+	if len(p.NetworkTools) > 0 {
+		findings = append(findings, "runs network tools: "+strings.Join(p.NetworkTools, ", "))
+	}
+	switch {
+	case len(findings) > 0:
+		return strings.Join(findings, "; ")
+	case p.EntrypointOnly:
+		return "entrypoint only, distroless candidate if the container started during observation"
+	case len(p.Binaries) == 1:
+		return "entrypoint only, but probes or hooks run " + strings.Join(slices.DeleteFunc(slices.Clone(p.Probes), func(b string) bool { return !isTool(b) }), ", ")
+	case len(p.Binaries) == 0:
+		return "no executions observed"
+	}
+	return "runs helper programs"
+}
+
+// isTool 报告程序是否是 shell、包管理器或网络工具
+func isTool(binary string) bool {
+	name := path.Base(binary)
+	return slices.Contains(shells, name) || slices.Contains(packageManagers, name) || slices.Contains(networkTools, name)
+}
+
+// classifyProcesses 按程序名对容器执行过的程序分类，probes 中的程序名是探针和钩子执行的程序，不计入可疑程序。
+// 探针用到的 shell 和工具仍然需要留在镜像中，此时容器不是 EntrypointOnly
+func classifyProcesses(container string, binaries, probes []string) ProcessProfile {
+	p := ProcessProfile{Container: container}
+	for _, b := range binaries {
+		if slices.Contains(probes, path.Base(b)) {
+			p.Probes = append(p.Probes, b)
+			continue
+		}
+		p.Binaries = append(p.Binaries, b)
+	}
+	for _, b := range p.Binaries {
+		name := path.Base(b)
+		switch {
+		case slices.Contains(shells, name):
+			p.Shells = append(p.Shells, b)
+		case slices.Contains(packageManagers, name):
+			p.PackageManagers = append(p.PackageManagers, b)
+		case slices.Contains(networkTools, name):
+			p.NetworkTools = append(p.NetworkTools, b)
+		}
+	}
+	p.EntrypointOnly = len(p.Binaries) == 1 && !p.Suspicious() && !slices.ContainsFunc(p.Probes, isTool)
+	return p
+}
+
+// execCommands 返回容器的 exec 探针和生命周期钩子执行的程序名。以 sh -c 执行的脚本同时返回脚本的第一个程序
+func execCommands(c map[string]any) []string {
+	var names []string
+	for _, handler := range []any{
+		nested(c, "livenessProbe", "exec", "command"),
+		nested(c, "readinessProbe", "exec", "command"),
+		nested(c, "startupProbe", "exec", "command"),
+		nested(c, "lifecycle", "postStart", "exec", "command"),
+		nested(c, "lifecycle", "preStop", "exec", "command"),
+	} {
+		command, _ := handler.([]any)
+		if len(command) == 0 {
+			continue
+		}
+		name, _ := command[0].(string)
+		names = append(names, path.Base(name))
+		if script, _ := command[len(command)-1].(string); slices.Contains(shells, path.Base(name)) && len(command) > 2 && command[1] == "-c" {
+			if fields := strings.Fields(script); len(fields) > 0 {
+				names = append(names, path.Base(fields[0]))
+			}
+		}
+	}
+	return names
+}
+
+// ObservedProcesses 返回工作负载每个容器在 observe 期间执行过的程序及其分类，
+// observed 为 false 表示该工作负载没有任何观测数据
+func ObservedProcesses(m *Manifest) (profiles []ProcessProfile, observed bool, err error) {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil, false, fmt.Errorf("unsupported kind %s", m.Kind())
+	}
+	pods, err := db.ObservedPods(workload)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(pods) == 0 {
+		return nil, false, nil
+	}
+	processes, err := db.GetProcessesByWorkload(workload)
+	if err != nil {
+		return nil, true, err
+	}
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		profiles = append(profiles, classifyProcesses(name, forContainer(processes, name), execCommands(c)))
+	}
+	return profiles, true, nil
+}
+
+// processContext 根据容器执行过的程序告诉 LLM 可以收紧到什么程度。
+// 容器在 observe 开始前启动时看不到其入口程序，没有执行记录的容器不做判断；
+// 执行过的程序与 capabilities 无关，只有没有观测到任何 capability 时才建议 drop ALL
+func processContext(m *Manifest, job *Job) error {
+	profiles, observed, err := ObservedProcesses(m)
+	if err != nil {
+		return fmt.Errorf("observed processes: %w", err)
+	}
+	if !observed {
+		return nil
+	}
+	caps, _, err := ObservedCapabilities(m)
+	if err != nil {
+		return fmt.Errorf("observed capabilities: %w", err)
+	}
+	for _, p := range profiles {
+		switch {
+		case p.Suspicious():
+			job.addContext("observe 期间容器 %s 执行了 %s，这些程序依赖镜像中的 shell 或工具，请不要假设可以换用 distroless 镜像。", p.Container, strings.Join(slices.Concat(p.Shells, p.PackageManagers, p.NetworkTools), ", "))
+		case p.EntrypointOnly && len(forContainer(caps, p.Container)) > 0:
+			job.addContext("observe 期间容器 %s 只执行了入口程序 %s（前提是容器在 observe 期间启动过，否则看不到入口程序），但它使用了 capabilities %s，请保留这些 capabilities。",
+				p.Container, p.Binaries[0], strings.Join(forContainer(caps, p.Container), ", "))
+		case p.EntrypointOnly:
+			job.addContext("observe 期间容器 %s 只执行了入口程序 %s，且没有使用任何 capability。如果容器在 observe 期间启动过（否则看不到入口程序，这个结论不成立），可以设置 allowPrivilegeEscalation: false 并 drop ALL capabilities。",
+				p.Container, p.Binaries[0])
+		}
+	}
+	return nil
+}
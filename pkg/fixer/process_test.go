@@ -0,0 +1,87 @@
+package fixer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyProcesses(t *testing.T) {
+	tests := []struct {
+		name     string
+		binaries []string
+		probes   []string
+		want     ProcessProfile
+		verdict  string
+	}{
+		{
+			name:     "entrypoint only",
+			binaries: []string{"/app/server"},
+			want:     ProcessProfile{Binaries: []string{"/app/server"}, EntrypointOnly: true},
+			verdict:  "entrypoint only, distroless candidate if the container started during observation",
+		},
+		{
+			name:     "probe binaries are not suspicious",
+			binaries: []string{"/app/server", "/usr/bin/curl", "/bin/grpc_health_probe"},
+			probes:   []string{"curl", "grpc_health_probe"},
+			want:     ProcessProfile{Binaries: []string{"/app/server"}, Probes: []string{"/usr/bin/curl", "/bin/grpc_health_probe"}},
+			verdict:  "entrypoint only, but probes or hooks run /usr/bin/curl",
+		},
+		{
+			name:     "probe shell keeps the image from being distroless",
+			binaries: []string{"/bin/sh", "/app/server"},
+			probes:   []string{"sh"},
+			want:     ProcessProfile{Binaries: []string{"/app/server"}, Probes: []string{"/bin/sh"}},
+			verdict:  "entrypoint only, but probes or hooks run /bin/sh",
+		},
+		{
+			name:     "probe helper is not a tool",
+			binaries: []string{"/app/server", "/bin/grpc_health_probe"},
+			probes:   []string{"grpc_health_probe"},
+			want:     ProcessProfile{Binaries: []string{"/app/server"}, Probes: []string{"/bin/grpc_health_probe"}, EntrypointOnly: true},
+			verdict:  "entrypoint only, distroless candidate if the container started during observation",
+		},
+		{
+			name:     "suspicious programs",
+			binaries: []string{"/bin/bash", "/usr/bin/apt-get", "/usr/bin/wget", "/app/server"},
+			want: ProcessProfile{
+				Binaries: []string{"/bin/bash", "/usr/bin/apt-get", "/usr/bin/wget", "/app/server"},
+				Shells:   []string{"/bin/bash"}, PackageManagers: []string{"/usr/bin/apt-get"}, NetworkTools: []string{"/usr/bin/wget"},
+			},
+			verdict: "spawns shells: /bin/bash; runs package managers: /usr/bin/apt-get; runs network tools: /usr/bin/wget",
+		},
+		{
+			name:     "helpers",
+			binaries: []string{"/app/server", "/app/worker"},
+			want:     ProcessProfile{Binaries: []string{"/app/server", "/app/worker"}},
+			verdict:  "runs helper programs",
+		},
+		{
+			name:    "nothing observed",
+			verdict: "no executions observed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyProcesses("app", tt.binaries, tt.probes)
+			tt.want.Container = "app"
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classifyProcesses() = %+v, want %+v", got, tt.want)
+			}
+			if verdict := got.Verdict(); verdict != tt.verdict {
+				t.Errorf("Verdict() = %q, want %q", verdict, tt.verdict)
+			}
+		})
+	}
+}
+
+func TestExecCommands(t *testing.T) {
+	c := map[string]any{
+		"livenessProbe":  map[string]any{"exec": map[string]any{"command": []any{"/bin/sh", "-c", "curl -f localhost:8080 || exit 1"}}},
+		"readinessProbe": map[string]any{"exec": map[string]any{"command": []any{"/bin/grpc_health_probe", "-addr=:9000"}}},
+		"lifecycle":      map[string]any{"preStop": map[string]any{"exec": map[string]any{"command": []any{"nginx", "-s", "quit"}}}},
+		"startupProbe":   map[string]any{"httpGet": map[string]any{"path": "/", "port": 8080}},
+	}
+	if got, want := execCommands(c), []string{"sh", "curl", "grpc_health_probe", "nginx"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("execCommands() = %q, want %q", got, want)
+	}
+}
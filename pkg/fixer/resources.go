@@ -0,0 +1,210 @@
+package fixer
+
+import (
+	"errors"
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/db"
+	"strings"
+	"time"
+)
+
+// ErrInsufficientSamples 表示观测到的指标样本不足以给出推荐
+var ErrInsufficientSamples = errors.New("insufficient metric samples")
+
+// oomPeakWindow 是没有 memory limit 的容器 OOM 前后查找内存使用峰值的时间范围
+const oomPeakWindow = 5 * time.Minute
+
+// ResourceRecommendation 是根据观测指标计算出的单个容器的资源请求与限制，
+// Container 为空表示样本来自未区分容器的旧数据，是整个 Pod 的合计
+type ResourceRecommendation struct {
+	Container     string
+	CPURequest    int64 // 毫核
+	CPULimit      int64 // 毫核
+	MemoryRequest int64 // 字节
+	MemoryLimit   int64 // 字节
+	Samples       int
+	Rollups       int   // 样本中已降采样的桶数，非零时百分位为近似值
+	OOMLimit      int64 // 容器因 OOM 被终止时的最大 memory limit，memory limit 不会低于它
+	OOMPeak       int64 // 容器在没有 memory limit 时因 OOM 被终止前后观测到的最大内存使用，memory limit 不会低于它
+	Pods          []string
+	From          time.Time
+	To            time.Time
+}
+
+// RecommendResources 在数据库中按容器汇总工作负载所有 Pod 的指标，以配置的百分位加余量计算资源请求与限制。
+// 容器曾因 OOM 被终止时，memory limit 高于当时的 limit；当时没有 limit 时，高于 OOM 前后观测到的最大内存使用
+func RecommendResources(m *Manifest) (map[string]*ResourceRecommendation, error) {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %s", m.Kind())
+	}
+	from, to := metricsWindow()
+	aggregates, err := db.AggregateMetrics(workload, from, to, conf.Resources.RequestPercentile, conf.Resources.LimitPercentile)
+	if err != nil {
+		return nil, err
+	}
+
+	incidents, err := db.GetIncidentsByWorkload(workload, from)
+	if err != nil {
+		return nil, err
+	}
+	peaks, err := db.GetOOMPeakMemoryByWorkload(workload, from, oomPeakWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	recs := map[string]*ResourceRecommendation{}
+	for container, a := range aggregates {
+		total += a.Samples
+		if a.Samples >= int64(conf.Resources.MinSamples) {
+			rec := recommend(a)
+			if limit := oomLimit(incidents[container]); limit > 0 {
+				rec.OOMLimit = limit
+				rec.MemoryLimit = max(rec.MemoryLimit, roundUpMiB(withHeadroom(limit)+1))
+			}
+			if peak := peaks[container]; peak > 0 {
+				rec.OOMPeak = peak
+				rec.MemoryLimit = max(rec.MemoryLimit, roundUpMiB(withHeadroom(peak)+1))
+			}
+			recs[container] = rec
+		}
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("%w: %d observed, at least %d per container required", ErrInsufficientSamples, total, conf.Resources.MinSamples)
+	}
+	return recs, nil
+}
+
+// metricsWindow 返回推荐所使用的指标时间范围 [from, to)
+func metricsWindow() (from, to time.Time) {
+	to = time.Now().Add(time.Second)
+	if conf.Resources.Window > 0 {
+		from = to.Add(-time.Duration(conf.Resources.Window) * time.Hour)
+	}
+	return from, to
+}
+
+// recommend 根据单个容器的指标汇总计算推荐值
+func recommend(a db.MetricAggregate) *ResourceRecommendation {
+	rec := &ResourceRecommendation{Container: a.Container, Samples: int(a.Samples), Rollups: int(a.Rollups), Pods: a.Pods, From: a.From, To: a.To}
+	rec.CPURequest = max(withHeadroom(a.CPU.Percentile(conf.Resources.RequestPercentile)), 1)
+	rec.CPULimit = max(withHeadroom(a.CPU.Percentile(conf.Resources.LimitPercentile)), rec.CPURequest)
+	rec.MemoryRequest = roundUpMiB(withHeadroom(a.Memory.Percentile(conf.Resources.RequestPercentile)))
+	rec.MemoryLimit = max(roundUpMiB(withHeadroom(a.Memory.Percentile(conf.Resources.LimitPercentile))), rec.MemoryRequest)
+	return rec
+}
+
+// Resources 返回容器 resources 字段的内容
+func (r *ResourceRecommendation) Resources() map[string]any {
+	return map[string]any{
+		"requests": map[string]any{"cpu": fmt.Sprintf("%dm", r.CPURequest), "memory": fmt.Sprintf("%dMi", r.MemoryRequest>>20)},
+		"limits":   map[string]any{"cpu": fmt.Sprintf("%dm", r.CPULimit), "memory": fmt.Sprintf("%dMi", r.MemoryLimit>>20)},
+	}
+}
+
+// Explain 说明推荐值所依据的样本
+func (r *ResourceRecommendation) Explain() string {
+	target := "整个 Pod"
+	if r.Container != "" {
+		target = "容器 " + r.Container
+	}
+	rollups := ""
+	if r.Rollups > 0 {
+		rollups = fmt.Sprintf("（其中部分样本已降采样为 %d 个时间桶，百分位为近似值）", r.Rollups)
+	}
+	oom := ""
+	if r.OOMLimit > 0 {
+		oom = fmt.Sprintf("；容器曾在 memory limit 为 %dMi 时因 OOM 被终止，memory limit 已提高到该值以上", r.OOMLimit>>20)
+	}
+	if r.OOMPeak > 0 {
+		oom += fmt.Sprintf("；容器曾在没有 memory limit 时因 OOM 被终止，当时的内存使用最高为 %dMi，memory limit 已提高到该值以上", r.OOMPeak>>20)
+	}
+	return fmt.Sprintf("%s：基于 Pod %s 在 %s 至 %s 期间的 %d 条指标样本%s，requests 取 P%d、limits 取 P%d，并增加 %d%% 余量：requests cpu=%dm memory=%dMi，limits cpu=%dm memory=%dMi%s",
+		target, strings.Join(r.Pods, ", "), r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), r.Samples, rollups,
+		conf.Resources.RequestPercentile, conf.Resources.LimitPercentile, conf.Resources.Headroom,
+		r.CPURequest, r.MemoryRequest>>20, r.CPULimit, r.MemoryLimit>>20, oom)
+}
+
+// recommendResources 将资源推荐直接写入清单，或作为上下文交给 LLM
+func recommendResources(m *Manifest, job *Job) error {
+	if err := pressureContext(m, job); err != nil {
+		return fmt.Errorf("recommend resources: %w", err)
+	}
+
+	recs, err := RecommendResources(m)
+	if errors.Is(err, ErrInsufficientSamples) {
+		job.addContext("没有足够的历史指标来推荐资源配置（%v），请勿编造具体的 CPU 和内存数值。", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("recommend resources: %w", err)
+	}
+
+	inject := conf.Resources.Mode == "inject"
+	containers := m.Containers(true)
+	for _, c := range containers {
+		name, _ := c["name"].(string)
+		rec, ok := recs[name]
+		switch {
+		case !ok && recs[""] == nil:
+			job.addContext("容器 %s 没有足够的历史指标，请勿为其编造具体的 CPU 和内存数值。", name)
+		case !ok:
+			// 只有未区分容器的旧数据时，交由下面按整个 Pod 处理
+		case inject:
+			c["resources"] = rec.Resources()
+			job.pin(name, c["resources"], "resources")
+			m.Modified = true
+			job.addContext("已根据观测数据为容器 %s 设置 resources，请保持不变。%s", name, rec.Explain())
+		default:
+			job.addContext("请据此设置容器 %s 的 CPU 和内存 requests 与 limits。%s", name, rec.Explain())
+		}
+	}
+
+	if rec, ok := recs[""]; ok && len(recs) == 1 {
+		if inject && len(containers) == 1 {
+			name, _ := containers[0]["name"].(string)
+			containers[0]["resources"] = rec.Resources()
+			job.pin(name, containers[0]["resources"], "resources")
+			m.Modified = true
+			job.addContext("已根据观测数据为容器 %v 设置 resources，请保持不变。%s", containers[0]["name"], rec.Explain())
+		} else {
+			job.addContext("整个 Pod 的资源使用观测结果如下，请据此设置 CPU 和内存的 requests 与 limits（多容器时按各容器职责分配）。%s", rec.Explain())
+		}
+	}
+	return nil
+}
+
+// pressureContext 将观测到的 CPU 限流和容器重启作为上下文交给 LLM，提示其不要收紧相应的资源
+func pressureContext(m *Manifest, job *Job) error {
+	workload, _ := m.Workload()
+	from, to := metricsWindow()
+	pressure, err := db.GetPressureByWorkload(workload, from, to)
+	if err != nil {
+		return err
+	}
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		p, ok := pressure[name]
+		if !ok {
+			continue
+		}
+		if p.MaxThrottling >= 0.01 {
+			job.addContext("容器 %s 在观测期间 CPU 被限流，被限流的周期占比最高 %.0f%%、平均 %.0f%%，CPU limit 不应低于实际使用的峰值。", name, p.MaxThrottling*100, p.AvgThrottling*100)
+		}
+		if p.Restarts > 0 {
+			job.addContext("容器 %s 在观测期间共重启 %d 次，可能存在内存不足导致的 OOM，memory limit 不应低于实际使用的峰值。", name, p.Restarts)
+		}
+	}
+	return nil
+}
+
+func withHeadroom(v int64) int64 {
+	return (v*int64(100+conf.Resources.Headroom) + 99) / 100
+}
+
+func roundUpMiB(v int64) int64 {
+	const mib = 1 << 20
+	return max((v+mib-1)/mib, 1) * mib
+}
@@ -0,0 +1,194 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// writableRoots 是常见的运行时可写目录，value 为折叠挂载点时保留的路径深度
+var writableRoots = map[string]int{
+	"/tmp":       1,
+	"/var/tmp":   2,
+	"/run":       1,
+	"/var/run":   2,
+	"/var/cache": 3,
+	"/var/log":   3,
+	"/var/lib":   3,
+	"/home":      2,
+	"/root":      1,
+}
+
+// sharedRoots 下折叠得到的目录（如 /home/node、/var/lib/dpkg、/root）常常同时存放镜像自带的内容，
+// 不能整体挂载，只挂载写入文件所在的更深一层的目录
+var sharedRoots = []string{"/var/lib", "/home", "/root"}
+
+// imageRoots 下通常是镜像自带的内容，挂载 emptyDir 会将其覆盖
+var imageRoots = []string{
+	"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/etc", "/opt",
+	"/app", "/srv", "/var/www", "/docker-entrypoint.d",
+}
+
+// pseudoRoots 下的文件不在容器根文件系统上
+var pseudoRoots = []string{"/dev", "/proc", "/sys"}
+
+var volumeNameRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+func under(p, root string) bool {
+	return p == root || strings.HasPrefix(p, root+"/")
+}
+
+// mountPoint 将写入的文件路径折叠为合适的挂载点，例如
+// /tmp/a/b -> /tmp，/var/cache/nginx/client_temp/1 -> /var/cache/nginx，
+// sharedRoots 下则使用文件所在的目录，例如 /home/node/.npm/_logs/1.log -> /home/node/.npm/_logs。
+// 不在常见可写目录下的路径无法可靠地确定挂载点，ok 为 false；
+// 文件直接写在 sharedRoots 下折叠得到的目录中（如 /home/node/.bash_history）时，挂载会覆盖镜像内容，conflict 为 true
+func mountPoint(file string) (mp string, ok, conflict bool) {
+	file = path.Clean(file)
+	for root, depth := range writableRoots {
+		if !under(file, root) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(file, "/"), "/")
+		if slices.Contains(sharedRoots, root) {
+			if len(parts)-1 <= depth {
+				return "", false, true
+			}
+			return path.Dir(file), true, false
+		}
+		// 文件本身不能作为挂载点，至少保留到其父目录
+		depth = min(depth, max(len(parts)-1, strings.Count(root, "/")))
+		return "/" + strings.Join(parts[:depth], "/"), true, false
+	}
+	return "", false, false
+}
+
+// WritableMounts 将观测到的写入路径折叠为挂载点，并去掉被其他挂载点包含的路径。
+// 已有卷挂载（existing 为其 mountPath）下的写入不需要新的挂载点，先被去掉。
+// 若有写入会落到镜像内容上，返回这些冲突的路径；不在常见可写目录下的路径不自动挂载，在 unmapped 中返回
+func WritableMounts(files, existing []string) (mounts, conflicts, unmapped []string) {
+	var candidates []string
+	for _, f := range files {
+		if !strings.HasPrefix(f, "/") || slices.ContainsFunc(pseudoRoots, func(r string) bool { return under(f, r) }) {
+			continue
+		}
+		f = path.Clean(f)
+		if slices.ContainsFunc(existing, func(e string) bool { return under(f, path.Clean(e)) }) {
+			continue
+		}
+		if slices.ContainsFunc(imageRoots, func(r string) bool { return under(f, r) }) {
+			conflicts = append(conflicts, f)
+			continue
+		}
+		mp, ok, conflict := mountPoint(f)
+		switch {
+		case conflict:
+			conflicts = append(conflicts, f)
+			continue
+		case !ok:
+			unmapped = append(unmapped, f)
+			continue
+		}
+		candidates = append(candidates, mp)
+	}
+	slices.Sort(candidates)
+	candidates = slices.Compact(candidates)
+	for _, c := range candidates {
+		if !slices.ContainsFunc(mounts, func(m string) bool { return under(c, m) }) {
+			mounts = append(mounts, c)
+		}
+	}
+	return mounts, conflicts, unmapped
+}
+
+func volumeName(mountPath string) string {
+	name := "kubefix" + strings.TrimRight(volumeNameRe.ReplaceAllString(strings.ToLower(mountPath), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
+
+// readOnlyRootFilesystem 设置 readOnlyRootFilesystem: true，并为观测到的每个写入目录添加 emptyDir 卷
+func readOnlyRootFilesystem(m *Manifest, job *Job) error {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil
+	}
+	// 只有指标数据时无法区分“没有写入文件”和“没有被观测”
+	observed, err := db.BehaviourObserved(workload)
+	if err != nil {
+		return fmt.Errorf("observed behaviour: %w", err)
+	}
+	if !observed {
+		job.warn("no behaviour was observed for %s/%s, root filesystem was not made read-only", m.Kind(), m.Name())
+		job.addContext("Falco 没有观测到该工作负载的行为，请勿根据猜测设置 readOnlyRootFilesystem 或添加可写卷。")
+		return nil
+	}
+	files, err := db.GetFilesByWorkload(workload)
+	if err != nil {
+		return fmt.Errorf("observed files: %w", err)
+	}
+
+	podSpec := m.PodSpec()
+	volumes, _ := podSpec["volumes"].([]any)
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		volumeMounts, _ := c["volumeMounts"].([]any)
+		var existing []string
+		for _, v := range volumeMounts {
+			if mp, _ := nested(asMap(v), "mountPath").(string); mp != "" {
+				existing = append(existing, mp)
+			}
+		}
+		mounts, conflicts, unmapped := WritableMounts(forContainer(files, name), existing)
+		if len(conflicts) > 0 {
+			job.warn("refusing to make root filesystem of container %s read-only: writes to image content %s", name, strings.Join(conflicts, ", "))
+			job.addContext("observe 期间容器 %s 写入了镜像自带的路径（%s），请不要为其设置 readOnlyRootFilesystem: true。", name, strings.Join(conflicts, ", "))
+			continue
+		}
+		if len(unmapped) > 0 {
+			job.warn("refusing to make root filesystem of container %s read-only: writes to %s need a volume, and an emptyDir would hide their data",
+				name, strings.Join(unmapped, ", "))
+			job.addContext("observe 期间容器 %s 写入了 %s，这些路径可能需要持久化的卷，无法自动挂载 emptyDir，请不要为其设置 readOnlyRootFilesystem: true。",
+				name, strings.Join(unmapped, ", "))
+			continue
+		}
+
+		ensureMap(c, "securityContext")["readOnlyRootFilesystem"] = true
+		job.pin(name, true, "securityContext", "readOnlyRootFilesystem")
+		for _, mp := range mounts {
+			volume := volumeName(mp)
+			mount := map[string]any{"name": volume, "mountPath": mp}
+			volumeMounts = append(volumeMounts, mount)
+			job.pinItem(name, "mountPath", mount, "volumeMounts")
+			if !slices.ContainsFunc(volumes, func(v any) bool { return nested(asMap(v), "name") == volume }) {
+				emptyDir := map[string]any{"name": volume, "emptyDir": map[string]any{}}
+				volumes = append(volumes, emptyDir)
+				job.pinItem("", "name", emptyDir, "volumes")
+			}
+		}
+		if len(volumeMounts) > 0 {
+			c["volumeMounts"] = volumeMounts
+		}
+		m.Modified = true
+
+		if len(mounts) == 0 {
+			job.addContext("observe 期间容器 %s 没有写入文件，已为其设置 readOnlyRootFilesystem: true，请保持不变。", name)
+		} else {
+			job.addContext("已为容器 %s 设置 readOnlyRootFilesystem: true，并根据观测到的写入路径挂载了 emptyDir 卷（%s），请保持不变。", name, strings.Join(mounts, ", "))
+		}
+	}
+	if len(volumes) > 0 {
+		podSpec["volumes"] = volumes
+	}
+	return nil
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
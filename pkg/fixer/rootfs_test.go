@@ -0,0 +1,102 @@
+package fixer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMountPoint(t *testing.T) {
+	tests := []struct {
+		file     string
+		mp       string
+		ok       bool
+		conflict bool
+	}{
+		{"/tmp/a/b", "/tmp", true, false},
+		{"/tmp/x", "/tmp", true, false},
+		{"/var/tmp/a", "/var/tmp", true, false},
+		{"/var/cache/nginx/client_temp/1", "/var/cache/nginx", true, false},
+		// 文件本身不能作为挂载点
+		{"/var/cache/x", "/var/cache", true, false},
+		{"/var/log/nginx/access.log", "/var/log/nginx", true, false},
+		{"/run/nginx.pid", "/run", true, false},
+		{"/tmp/../var/run/app.pid", "/var/run", true, false},
+		// 共享目录使用文件所在的目录，不覆盖同级的镜像内容
+		{"/home/node/.npm/_logs/1.log", "/home/node/.npm/_logs", true, false},
+		{"/home/node/.cache/x", "/home/node/.cache", true, false},
+		{"/root/.npm/x", "/root/.npm", true, false},
+		{"/var/lib/nginx/body/1", "/var/lib/nginx/body", true, false},
+		{"/home/node/.bash_history", "", false, true},
+		{"/root/.bash_history", "", false, true},
+		{"/var/lib/dpkg/status", "", false, true},
+		{"/data/db/x", "", false, false},
+		{"/varlog/x", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			mp, ok, conflict := mountPoint(tt.file)
+			if mp != tt.mp || ok != tt.ok || conflict != tt.conflict {
+				t.Errorf("mountPoint(%q) = %q, %v, %v, want %q, %v, %v", tt.file, mp, ok, conflict, tt.mp, tt.ok, tt.conflict)
+			}
+		})
+	}
+}
+
+func TestWritableMounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []string
+		existing  []string
+		mounts    []string
+		conflicts []string
+		unmapped  []string
+	}{
+		{
+			name:   "folds into one mount per directory",
+			files:  []string{"/tmp/a", "/tmp/b/c", "/var/cache/nginx/1", "/var/cache/nginx/2/3"},
+			mounts: []string{"/tmp", "/var/cache/nginx"},
+		},
+		{
+			name:   "drops nested candidates",
+			files:  []string{"/home/node/.npm/_cacache/index/a/b", "/home/node/.npm/_cacache/c", "/home/node/.npm/_logs/1.log"},
+			mounts: []string{"/home/node/.npm/_cacache", "/home/node/.npm/_logs"},
+		},
+		{
+			name:     "skips existing mounts",
+			files:    []string{"/tmp/a", "/data/db/x", "/var/log/app/x.log"},
+			existing: []string{"/data/", "/var/log"},
+			mounts:   []string{"/tmp"},
+		},
+		{
+			name:      "reports image content",
+			files:     []string{"/etc/nginx/conf.d/default.conf", "/app/cache/x", "/home/node/.bash_history", "/tmp/a"},
+			mounts:    []string{"/tmp"},
+			conflicts: []string{"/etc/nginx/conf.d/default.conf", "/app/cache/x", "/home/node/.bash_history"},
+		},
+		{
+			name:   "ignores pseudo filesystems and relative paths",
+			files:  []string{"/dev/null", "/proc/self/fd/1", "/sys/fs/cgroup/x", "relative/file"},
+			mounts: nil,
+		},
+		{
+			name:     "leaves unknown directories unmapped",
+			files:    []string{"/data/db/x", "/tmp/a"},
+			mounts:   []string{"/tmp"},
+			unmapped: []string{"/data/db/x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mounts, conflicts, unmapped := WritableMounts(tt.files, tt.existing)
+			if !reflect.DeepEqual(mounts, tt.mounts) {
+				t.Errorf("mounts = %q, want %q", mounts, tt.mounts)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %q, want %q", conflicts, tt.conflicts)
+			}
+			if !reflect.DeepEqual(unmapped, tt.unmapped) {
+				t.Errorf("unmapped = %q, want %q", unmapped, tt.unmapped)
+			}
+		})
+	}
+}
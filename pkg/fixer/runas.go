@@ -0,0 +1,102 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"slices"
+	"strings"
+)
+
+// runAsObservedUser 按 observe 期间进程实际使用的身份设置 runAsUser、runAsGroup 和 fsGroup，
+// 使 runAsNonRoot 不会因为随意选择的 UID 读不到镜像中的文件而失败。以 root 运行过的容器不做修改
+func runAsObservedUser(m *Manifest, job *Job) error {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil
+	}
+	pods, err := db.ObservedPods(workload)
+	if err != nil {
+		return fmt.Errorf("observed pods: %w", err)
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+	identities, err := db.GetIdentitiesByWorkload(workload)
+	if err != nil {
+		return fmt.Errorf("observed identities: %w", err)
+	}
+
+	var writerGIDs []int64
+	for _, c := range m.Containers(true) {
+		name, _ := c["name"].(string)
+		ids := identities[name]
+		all := slices.Concat(ids.Users, ids.Writers)
+		if len(all) == 0 {
+			job.addContext("没有观测到容器 %s 的进程身份，请勿猜测 runAsUser，应使用镜像中已有的非 root 用户。", name)
+			continue
+		}
+		if slices.ContainsFunc(all, func(id db.Identity) bool { return id.UID == 0 }) {
+			job.warn("refusing to set runAsUser for container %s: it was observed running as root", name)
+			job.addContext("observe 期间容器 %s 以 root（UID 0）运行，请不要为其设置 runAsNonRoot: true 或修改 runAsUser，否则应用可能无法读取镜像中的文件。", name)
+			continue
+		}
+		uids := distinct(all, func(id db.Identity) int64 { return id.UID })
+		if len(uids) > 1 {
+			job.warn("container %s was observed running as several users (%s), runAsUser was not set", name, joinInts(uids))
+			job.addContext("observe 期间容器 %s 以多个用户（UID %s）运行，请不要随意选择 runAsUser。", name, joinInts(uids))
+			continue
+		}
+
+		securityContext := ensureMap(c, "securityContext")
+		securityContext["runAsNonRoot"] = true
+		securityContext["runAsUser"] = uids[0]
+		job.pin(name, true, "securityContext", "runAsNonRoot")
+		job.pin(name, uids[0], "securityContext", "runAsUser")
+		known := slices.DeleteFunc(slices.Clone(all), func(id db.Identity) bool { return id.GID < 0 })
+		gids := distinct(known, func(id db.Identity) int64 { return id.GID })
+		if len(gids) == 1 {
+			securityContext["runAsGroup"] = gids[0]
+			job.pin(name, gids[0], "securityContext", "runAsGroup")
+			job.addContext("已根据 observe 期间的进程身份为容器 %s 设置 runAsNonRoot: true、runAsUser: %d、runAsGroup: %d，请保持不变。", name, uids[0], gids[0])
+		} else {
+			job.addContext("已根据 observe 期间的进程身份为容器 %s 设置 runAsNonRoot: true、runAsUser: %d，请保持不变。", name, uids[0])
+		}
+		m.Modified = true
+		for _, id := range ids.Writers {
+			if id.GID >= 0 && !slices.Contains(writerGIDs, id.GID) {
+				writerGIDs = append(writerGIDs, id.GID)
+			}
+		}
+	}
+
+	// 所有写入文件的进程属于同一个组时，卷应归该组所有
+	if len(writerGIDs) == 1 {
+		podSecurityContext := ensureMap(m.PodSpec(), "securityContext")
+		if _, set := podSecurityContext["fsGroup"]; !set {
+			podSecurityContext["fsGroup"] = writerGIDs[0]
+			job.pin("", writerGIDs[0], "securityContext", "fsGroup")
+			m.Modified = true
+			job.addContext("observe 期间所有写入文件的进程都属于组 %d，已设置 Pod 的 securityContext.fsGroup: %d，请保持不变。", writerGIDs[0], writerGIDs[0])
+		}
+	}
+	return nil
+}
+
+// distinct 返回按出现顺序去重后的键
+func distinct(ids []db.Identity, key func(db.Identity) int64) []int64 {
+	var result []int64
+	for _, id := range ids {
+		if k := key(id); !slices.Contains(result, k) {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+func joinInts(values []int64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprint(v)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,38 @@
+package fixer
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+)
+
+// ObservedSyscalls 返回工作负载所有 Pod 在 observe 期间按容器汇总的系统调用，
+// 以及各容器是否完整捕获了所有系统调用。未完整捕获的容器只记录了部分规则涉及的系统调用
+func ObservedSyscalls(m *Manifest) (syscalls map[string][]string, complete map[string]bool, err error) {
+	workload, ok := m.Workload()
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported kind %s", m.Kind())
+	}
+	if syscalls, err = db.GetSyscallsByWorkload(workload); err != nil {
+		return nil, nil, err
+	}
+	if complete, err = db.GetSyscallCaptureByWorkload(workload); err != nil {
+		return nil, nil, err
+	}
+	return syscalls, complete, nil
+}
+
+// SetSeccompProfile 将容器的 securityContext.seccompProfile 设置为指定的 localhost profile
+func SetSeccompProfile(m *Manifest, container, localhostProfile string) bool {
+	for _, c := range m.Containers(true) {
+		if c["name"] != container {
+			continue
+		}
+		ensureMap(c, "securityContext")["seccompProfile"] = map[string]any{
+			"type":             "Localhost",
+			"localhostProfile": localhostProfile,
+		}
+		m.Modified = true
+		return true
+	}
+	return false
+}
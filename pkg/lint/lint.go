@@ -10,13 +10,8 @@ import (
 	"path/filepath"
 )
 
-func LintFile(filePath, outputPath string) {
-	baseFileName := filepath.Base(filePath)
-	// fileNameWithoutExt := strings.TrimSuffix(baseFileName, filepath.Ext(baseFileName))
-	// outputFilePath := filepath.Join(conf.LintDir, fileNameWithoutExt+".txt")
-
-	fmt.Printf("Linting: %s (extracting only Reports data)\n", baseFileName)
-
+// run 对指定文件执行 kube-linter 并解析其 JSON 输出
+func run(filePath string) (Result, []byte, error) {
 	cmd := exec.Command("kube-linter", "lint", filePath, "--format", "json")
 	var out bytes.Buffer
 	var err bytes.Buffer
@@ -27,16 +22,38 @@ func LintFile(filePath, outputPath string) {
 
 	var lintResult Result
 	outputBytes := out.Bytes()
-
 	if err := json.Unmarshal(outputBytes, &lintResult); err != nil {
-		fmt.Printf("  Error: Could not parse JSON output to linter.Result: %v\n", err)
+		return lintResult, outputBytes, fmt.Errorf("could not parse JSON output to linter.Result: %w", err)
+	}
+	return lintResult, outputBytes, nil
+}
+
+// Messages 提取所有诊断信息
+func (r Result) Messages() []string {
+	var messages []string
+	for _, report := range r.Reports {
+		messages = append(messages, report.Diagnostic.Message)
+	}
+	return messages
+}
+
+func LintFile(filePath, outputPath string) {
+	baseFileName := filepath.Base(filePath)
+	// fileNameWithoutExt := strings.TrimSuffix(baseFileName, filepath.Ext(baseFileName))
+	// outputFilePath := filepath.Join(conf.LintDir, fileNameWithoutExt+".txt")
+
+	fmt.Printf("Linting: %s (extracting only Reports data)\n", baseFileName)
+
+	lintResult, outputBytes, err := run(filePath)
+	if err != nil {
+		fmt.Printf("  Error: %v\n", err)
 		fmt.Println(string(outputBytes))
 	}
 
 	var diagnosticOutput []byte
 	if len(lintResult.Reports) > 0 {
-		for _, report := range lintResult.Reports {
-			diagnosticOutput = append(diagnosticOutput, []byte(report.Diagnostic.Message)...)
+		for _, message := range lintResult.Messages() {
+			diagnosticOutput = append(diagnosticOutput, []byte(message)...)
 			diagnosticOutput = append(diagnosticOutput, []byte("\n")...)
 		}
 
@@ -48,3 +65,26 @@ func LintFile(filePath, outputPath string) {
 		fmt.Printf("  Results saved to: %s\n", outputPath)
 	}
 }
+
+// LintContent 在内存中的清单上执行 kube-linter，返回剩余的诊断信息
+func LintContent(content []byte) ([]string, error) {
+	tmp, err := os.CreateTemp("", "kubefix-*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("error writing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("error closing temp file: %w", err)
+	}
+
+	lintResult, _, err := run(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	return lintResult.Messages(), nil
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kubefix-cli/pkg/utils"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	fenceRe    = regexp.MustCompile("(?s)```[A-Za-z0-9_-]*[ \t]*\r?\n(.*?)```")
+	yamlKeyRe  = regexp.MustCompile(`^[A-Za-z0-9_."'/-]+:(\s|$)`)
+	manifestRe = regexp.MustCompile(`(?m)^(apiVersion|kind):`)
+)
+
+// ExtractManifest 从 LLM 的回复中找出 YAML 清单，并确认整个回复中恰好包含一个对象，
+// 且其 kind 和 name 与指定的一致，返回该对象对应的 YAML 文档。回复中有多个对象，
+// 或同一对象出现了内容不同的多个版本（例如修改前和修改后）时视为修复失败
+func ExtractManifest(response []byte, kind, name string) ([]byte, error) {
+	candidates := extractCandidates(string(response), 0)
+	if len(candidates) == 0 {
+		return nil, errors.New("no YAML found in LLM response")
+	}
+
+	var (
+		matched  []byte
+		versions []any
+		firstErr error
+		objects  []string
+	)
+	for _, candidate := range candidates {
+		doc, found, err := matchObject(candidate, kind, name)
+		for _, f := range found {
+			if !slices.Contains(objects, f) {
+				objects = append(objects, f)
+			}
+		}
+		if err != nil {
+			// 候选内容按可信程度排列，报告最可信的候选内容的错误
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		// 同一内容可能同时以代码块、去掉说明文字后的回复等形式出现，按解析后的内容比较
+		var content any
+		if err := yaml.Unmarshal(doc, &content); err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(versions, func(v any) bool { return reflect.DeepEqual(v, content) }) {
+			versions = append(versions, content)
+		}
+		if matched == nil {
+			matched = doc
+		}
+	}
+	if len(objects) > 1 {
+		return nil, fmt.Errorf("expected only %s/%s in LLM response, found %d objects: %s", kind, name, len(objects), strings.Join(objects, ", "))
+	}
+	if len(versions) > 1 {
+		return nil, fmt.Errorf("expected one version of %s/%s in LLM response, found %d different versions", kind, name, len(versions))
+	}
+	if matched == nil {
+		return nil, firstErr
+	}
+	return matched, nil
+}
+
+// extractCandidates 按可信程度列出回复中可能的 YAML 内容：
+// JSON 包装、Markdown 代码块、夹杂说明文字的 YAML，最后是原始回复
+func extractCandidates(response string, depth int) []string {
+	var candidates []string
+	trimmed := strings.TrimSpace(response)
+	if trimmed == "" || depth > 3 {
+		return nil
+	}
+
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var v any
+		if err := json.Unmarshal([]byte(trimmed), &v); err == nil {
+			candidates = append(candidates, fromJSON(v, depth)...)
+		}
+	}
+
+	for _, m := range fenceRe.FindAllStringSubmatch(response, -1) {
+		candidates = append(candidates, m[1])
+	}
+
+	if prose := stripProse(response); prose != "" && prose != trimmed {
+		candidates = append(candidates, prose)
+	}
+
+	if manifestRe.MatchString(trimmed) {
+		candidates = append(candidates, trimmed)
+	}
+	return candidates
+}
+
+// fromJSON 处理 JSON 格式的回复：本身就是 Kubernetes 对象时转换为 YAML，
+// 否则在其字符串字段中继续查找 YAML
+func fromJSON(v any, depth int) []string {
+	var candidates []string
+	switch val := v.(type) {
+	case map[string]any:
+		if _, ok := val["kind"]; ok {
+			if out, err := yaml.Marshal(val); err == nil {
+				candidates = append(candidates, string(out))
+			}
+			return candidates
+		}
+		for _, key := range slices.Sorted(maps.Keys(val)) {
+			candidates = append(candidates, fromJSON(val[key], depth)...)
+		}
+	case []any:
+		for _, item := range val {
+			candidates = append(candidates, fromJSON(item, depth)...)
+		}
+	case string:
+		if manifestRe.MatchString(val) {
+			candidates = append(candidates, extractCandidates(val, depth+1)...)
+		}
+	}
+	return candidates
+}
+
+// stripProse 去掉 YAML 前后的说明文字：从第一个 apiVersion/kind 行开始，
+// 到第一个不像 YAML 的顶层行为止
+func stripProse(response string) string {
+	loc := manifestRe.FindStringIndex(response)
+	if loc == nil {
+		return ""
+	}
+	lines := strings.Split(response[loc[0]:], "\n")
+	end := len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(line, "- ") || yamlKeyRe.MatchString(line) {
+			continue
+		}
+		end = i
+		break
+	}
+	return strings.TrimSpace(strings.Join(lines[:end], "\n"))
+}
+
+// matchObject 解析候选内容，确认其中只有一个对象且为指定 kind 和 name 的对象，
+// 同时返回候选内容中找到的所有对象；无法解析时不返回对象
+func matchObject(candidate, kind, name string) ([]byte, []string, error) {
+	if _, err := utils.ParseYAMLContent([]byte(candidate)); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		matched []byte
+		found   []string
+	)
+	for _, doc := range bytes.Split([]byte(candidate), []byte("---\n")) {
+		resources, err := utils.ParseYAMLContent(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, r := range resources {
+			found = append(found, r.GetKind()+"/"+r.GetName())
+			if r.GetKind() == kind && r.GetName() == name {
+				matched = doc
+			}
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		return nil, nil, errors.New("no Kubernetes object found in LLM response")
+	case len(found) > 1:
+		return nil, found, fmt.Errorf("expected exactly one object %s/%s, found %d: %s", kind, name, len(found), strings.Join(found, ", "))
+	case matched == nil:
+		return nil, found, fmt.Errorf("expected %s/%s, found %s", kind, name, found[0])
+	default:
+		return append(bytes.TrimSpace(matched), '\n'), found, nil
+	}
+}
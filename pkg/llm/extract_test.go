@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+`
+
+func TestExtractManifest(t *testing.T) {
+	fixed := strings.Replace(deployment, "replicas: 2", "replicas: 3", 1)
+	service := "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+	tests := []struct {
+		name     string
+		response string
+		want     string // 期望返回的文档，为空时期望返回错误
+		err      string
+	}{
+		{
+			name:     "raw yaml",
+			response: deployment,
+			want:     deployment,
+		},
+		{
+			name:     "json wrapped",
+			response: `{"manifest": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n"}`,
+			want:     deployment,
+		},
+		{
+			name:     "json object",
+			response: `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web"}, "spec": {"replicas": 2}}`,
+			want:     deployment,
+		},
+		{
+			name:     "fenced block with prose",
+			response: "Here is the fixed manifest:\n\n```yaml\n" + deployment + "```\n\nI set the replicas to 2.",
+			want:     deployment,
+		},
+		{
+			name:     "prose around unfenced yaml",
+			response: "Sure.\n" + deployment + "This keeps two replicas.",
+			want:     deployment,
+		},
+		{
+			name:     "same object repeated with the same content",
+			response: "```yaml\n" + deployment + "```\nor, without fences:\n\n" + deployment,
+			want:     deployment,
+		},
+		{
+			name:     "prose only",
+			response: "I cannot fix this manifest without more information.",
+			err:      "no YAML found",
+		},
+		{
+			name:     "several documents",
+			response: "```yaml\n" + deployment + "---\n" + service + "```",
+			err:      "found 2 objects",
+		},
+		{
+			name:     "several fences with different objects",
+			response: "```yaml\n" + deployment + "```\n\n```yaml\n" + service + "```",
+			err:      "found 2 objects",
+		},
+		{
+			name:     "same object twice with different content",
+			response: "Before:\n```yaml\n" + deployment + "```\nAfter:\n```yaml\n" + fixed + "```",
+			err:      "2 different versions",
+		},
+		{
+			name:     "other object",
+			response: "```yaml\n" + strings.Replace(deployment, "name: web", "name: api", 1) + "```",
+			err:      "expected Deployment/web, found Deployment/api",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractManifest([]byte(tt.response), "Deployment", "web")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ExtractManifest() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractManifest() error = %v", err)
+			}
+			if !sameYAML(t, string(got), tt.want) {
+				t.Errorf("ExtractManifest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// sameYAML 按解析后的内容比较两个 YAML 文档
+func sameYAML(t *testing.T, a, b string) bool {
+	t.Helper()
+	var va, vb any
+	if err := yaml.Unmarshal([]byte(a), &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(b), &vb); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
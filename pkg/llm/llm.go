@@ -1,35 +1,41 @@
 package llm
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"kubefix-cli/conf"
-	"net/http"
 	"strings"
 )
 
-func queryLLM(body string) ([]byte, error) {
-	req, err := http.NewRequest("POST", conf.LLMApi, strings.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
-	}
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error sending request: %v", err)
-	}
-	defer resp.Body.Close()
+// Message 表示对话中的一条消息
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Conversation 记录与 LLM 的多轮对话，用于将复检结果反馈给 LLM
+type Conversation struct {
+	Messages []Message
+	provider LLMProvider
+}
 
-	result, err := io.ReadAll(resp.Body)
+// send 发送当前对话，并将 LLM 的回复追加到对话中
+func (c *Conversation) send() ([]byte, error) {
+	reply, err := c.provider.Chat(context.Background(), c.Messages)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response: %v", err)
+		return nil, err
 	}
-
-	return result, nil
+	c.Messages = append(c.Messages, Message{Role: RoleAssistant, Content: reply})
+	return []byte(reply), nil
 }
 
-func GenFix(resourceContent, lintContent []byte) ([]byte, error) {
+// NewFixConversation 创建一个以资源文件和诊断结果开头的修复对话，
+// observations 为根据观测数据生成的补充说明
+func NewFixConversation(provider LLMProvider, resourceContent, lintContent []byte, observations []string) *Conversation {
 	template := `我将提供kubernetes资源的yaml文件和kube-linter的诊断结果。请根据诊断结果修复yaml文件中的问题，在此过程中，你需要根据诊断内容去调用合适的MCP工具来查询必要的集群信息，在生成CPU和内存限制的时候，要查询容器的历史使用量，并按照最大使用量来生成资源限制。并返回修复后的yaml文件内容。修复后的内容必须是有效的yaml格式，并且可以直接应用到Kubernetes集群中。
 注意：请不要返回任何其他内容，只返回修复后的yaml文件内容。
 ---
@@ -48,10 +54,31 @@ func GenFix(resourceContent, lintContent []byte) ([]byte, error) {
 %s`
 
 	query := fmt.Sprintf(template, resourceContent, lintContent)
-	fixed, err := queryLLM(query)
-	if err != nil {
-		return nil, err
+	if len(observations) > 0 {
+		query += "\n---\n集群观测信息：\n" + strings.Join(observations, "\n")
 	}
-	return fixed, nil
+	return &Conversation{Messages: []Message{{Role: RoleUser, Content: query}}, provider: provider}
+}
+
+// Start 发送首轮修复请求
+func (c *Conversation) Start() ([]byte, error) {
+	return c.send()
 }
 
+// FollowUp 将上一轮修复结果的解析错误和剩余诊断作为新一轮对话发送给 LLM
+func (c *Conversation) FollowUp(diagnostics []string, parseErr error) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString("你上一次返回的内容仍然存在问题，请在其基础上继续修复，并返回完整的修复后的yaml文件内容。\n注意：请不要返回任何其他内容，只返回修复后的yaml文件内容。\n")
+	if parseErr != nil {
+		fmt.Fprintf(&sb, "---\n解析错误：\n%v\n", parseErr)
+	}
+	if len(diagnostics) > 0 {
+		sb.WriteString("---\n剩余诊断结果：\n")
+		for _, d := range diagnostics {
+			sb.WriteString(d)
+			sb.WriteString("\n")
+		}
+	}
+	c.Messages = append(c.Messages, Message{Role: RoleUser, Content: sb.String()})
+	return c.send()
+}
@@ -0,0 +1,255 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"kubefix-cli/conf"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider 按顺序返回预设的回复，并记录收到的对话
+type fakeProvider struct {
+	replies []string
+
+	mu       sync.Mutex
+	requests [][]Message
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, slices.Clone(messages))
+	if len(p.replies) == 0 {
+		return "", errors.New("fake provider has no reply left")
+	}
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return reply, nil
+}
+
+func TestConversationFollowUp(t *testing.T) {
+	provider := &fakeProvider{replies: []string{"first", "second"}}
+	c := NewFixConversation(provider, []byte("kind: Deployment"), []byte("lint finding"), []string{"observed caps"})
+
+	reply, err := c.Start()
+	if err != nil || string(reply) != "first" {
+		t.Fatalf("Start() = %q, %v", reply, err)
+	}
+	reply, err = c.FollowUp([]string{"remaining finding"}, errors.New("bad yaml"))
+	if err != nil || string(reply) != "second" {
+		t.Fatalf("FollowUp() = %q, %v", reply, err)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("provider received %d requests, want 2", len(provider.requests))
+	}
+	first := provider.requests[0]
+	if len(first) != 1 || !strings.Contains(first[0].Content, "lint finding") || !strings.Contains(first[0].Content, "observed caps") {
+		t.Errorf("first request = %+v", first)
+	}
+	second := provider.requests[1]
+	roles := []string{RoleUser, RoleAssistant, RoleUser}
+	if len(second) != len(roles) {
+		t.Fatalf("second request has %d messages, want %d", len(second), len(roles))
+	}
+	for i, role := range roles {
+		if second[i].Role != role {
+			t.Errorf("message %d role = %q, want %q", i, second[i].Role, role)
+		}
+	}
+	if !strings.Contains(second[2].Content, "bad yaml") || !strings.Contains(second[2].Content, "remaining finding") {
+		t.Errorf("follow-up message = %q", second[2].Content)
+	}
+	if len(c.Messages) != 4 {
+		t.Errorf("conversation has %d messages, want 4", len(c.Messages))
+	}
+}
+
+// statusSequence 依次以 codes 中的状态码响应，之后一直返回 200
+func statusSequence(codes ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(codes) {
+			w.WriteHeader(codes[n-1])
+			w.Write([]byte("failure"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return srv, &calls
+}
+
+func TestHTTPDoerRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		codes   []int
+		retries int
+		calls   int32
+		wantErr int // 期望的状态码，0 表示成功
+	}{
+		{"retries server errors", []int{503, 500}, 3, 3, 0},
+		{"retries rate limits", []int{429}, 1, 2, 0},
+		{"gives up after retries", []int{500, 502, 503}, 2, 3, 503},
+		{"does not retry client errors", []int{400}, 3, 1, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := statusSequence(tt.codes...)
+			defer srv.Close()
+			h := httpDoer{client: srv.Client(), retries: tt.retries, backoff: time.Millisecond}
+
+			result, err := h.do(context.Background(), srv.URL, nil, []byte("body"))
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("server called %d times, want %d", got, tt.calls)
+			}
+			if tt.wantErr == 0 {
+				if err != nil || string(result) != "ok" {
+					t.Errorf("do() = %q, %v", result, err)
+				}
+				return
+			}
+			var se *statusError
+			if !errors.As(err, &se) || se.code != tt.wantErr {
+				t.Errorf("do() error = %v, want status %d", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPDoerStopsOnCancel(t *testing.T) {
+	srv, calls := statusSequence(500, 500, 500)
+	defer srv.Close()
+	h := httpDoer{client: srv.Client(), retries: 2, backoff: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, err := h.do(ctx, srv.URL, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("do() error = %v, want context.Canceled", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server called %d times, want 1", got)
+	}
+}
+
+func TestProviders(t *testing.T) {
+	messages := []Message{{Role: RoleUser, Content: "fix"}, {Role: RoleAssistant, Content: "yaml"}, {Role: RoleUser, Content: "again"}}
+	tests := []struct {
+		provider string
+		path     string
+		reply    string
+		check    func(t *testing.T, r *http.Request, body []byte)
+	}{
+		{
+			provider: "openai",
+			path:     "/v1/chat/completions",
+			reply:    `{"choices":[{"message":{"role":"assistant","content":"fixed"}}]}`,
+			check: func(t *testing.T, r *http.Request, body []byte) {
+				if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("Authorization = %q", got)
+				}
+				var req openAIRequest
+				if err := json.Unmarshal(body, &req); err != nil {
+					t.Fatal(err)
+				}
+				if req.Model != "model" || req.MaxTokens != 100 || !slices.Equal(req.Messages, messages) {
+					t.Errorf("request = %+v", req)
+				}
+			},
+		},
+		{
+			provider: "ollama",
+			path:     "/api/chat",
+			reply:    `{"message":{"role":"assistant","content":"fixed"}}`,
+			check: func(t *testing.T, r *http.Request, body []byte) {
+				var req ollamaRequest
+				if err := json.Unmarshal(body, &req); err != nil {
+					t.Fatal(err)
+				}
+				if req.Stream || req.Options.NumPredict != 100 || !slices.Equal(req.Messages, messages) {
+					t.Errorf("request = %+v", req)
+				}
+			},
+		},
+		{
+			provider: "raw",
+			path:     "/fix",
+			reply:    "fixed",
+			check: func(t *testing.T, r *http.Request, body []byte) {
+				if want := render(messages); string(body) != want {
+					t.Errorf("body = %q, want %q", body, want)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("path = %q, want %q", r.URL.Path, tt.path)
+				}
+				body, _ := io.ReadAll(r.Body)
+				tt.check(t, r, body)
+				w.Write([]byte(tt.reply))
+			}))
+			defer srv.Close()
+
+			t.Setenv("KUBEFIX_TEST_API_KEY", "secret")
+			endpoint := srv.URL
+			switch tt.provider {
+			case "openai":
+				endpoint += "/v1/"
+			case "raw":
+				endpoint += "/fix"
+			}
+			provider, err := NewProvider(conf.LLMConfig{Provider: tt.provider, Endpoint: endpoint, Model: "model", MaxTokens: 100,
+				APIKeyEnv: "KUBEFIX_TEST_API_KEY", Timeout: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := provider.Chat(context.Background(), messages)
+			if err != nil || reply != "fixed" {
+				t.Errorf("Chat() = %q, %v", reply, err)
+			}
+		})
+	}
+}
+
+func TestOpenAIProviderWithoutChoices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer srv.Close()
+
+	provider, err := NewProvider(conf.LLMConfig{Provider: "openai", Endpoint: srv.URL, Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Chat(context.Background(), []Message{{Role: RoleUser, Content: "fix"}}); err == nil {
+		t.Error("Chat() succeeded without choices")
+	}
+}
+
+func TestNewProviderErrors(t *testing.T) {
+	if _, err := NewProvider(conf.LLMConfig{Provider: "openai"}); err == nil {
+		t.Error("NewProvider() accepted an empty endpoint")
+	}
+	if _, err := NewProvider(conf.LLMConfig{Provider: "unknown", Endpoint: "http://localhost"}); err == nil {
+		t.Error("NewProvider() accepted an unknown provider")
+	}
+}
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"context"
+	"kubefix-cli/conf"
+	"strings"
+)
+
+// OllamaProvider 调用 Ollama 的 /api/chat 接口
+type OllamaProvider struct {
+	cfg  conf.LLMConfig
+	http httpDoer
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaRequest struct {
+	Model    string        `json:"model"`
+	Messages []Message     `json:"messages"`
+	Stream   bool          `json:"stream"`
+	Options  ollamaOptions `json:"options"`
+}
+
+type ollamaResponse struct {
+	Message Message `json:"message"`
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	url := strings.TrimSuffix(p.cfg.Endpoint, "/")
+	if !strings.HasSuffix(url, "/api/chat") {
+		url += "/api/chat"
+	}
+
+	req := ollamaRequest{
+		Model:    p.cfg.Model,
+		Messages: messages,
+		Options: ollamaOptions{
+			Temperature: p.cfg.Temperature,
+			NumPredict:  p.cfg.MaxTokens,
+		},
+	}
+	var resp ollamaResponse
+	if err := p.http.postJSON(ctx, url, nil, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Message.Content, nil
+}
@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"kubefix-cli/conf"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider 调用兼容 OpenAI 的 chat completions 接口
+type OpenAIProvider struct {
+	cfg    conf.LLMConfig
+	apiKey string
+	http   httpDoer
+}
+
+type openAIRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Temperature float64   `json:"temperature"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	url := strings.TrimSuffix(p.cfg.Endpoint, "/")
+	if !strings.HasSuffix(url, "/chat/completions") {
+		url += "/chat/completions"
+	}
+	header := http.Header{}
+	if p.apiKey != "" {
+		header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	req := openAIRequest{
+		Model:       p.cfg.Model,
+		Messages:    messages,
+		Temperature: p.cfg.Temperature,
+		MaxTokens:   p.cfg.MaxTokens,
+	}
+	var resp openAIResponse
+	if err := p.http.postJSON(ctx, url, header, req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no choices in chat completion response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
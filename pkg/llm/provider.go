@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kubefix-cli/conf"
+	"net/http"
+	"os"
+	"time"
+)
+
+// LLMProvider 是 LLM 后端的统一接口，接收完整的对话并返回回复内容
+type LLMProvider interface {
+	Chat(ctx context.Context, messages []Message) (string, error)
+}
+
+// NewProvider 根据配置创建对应的 LLM 提供方
+func NewProvider(cfg conf.LLMConfig) (LLMProvider, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("llm endpoint for provider %q is not configured", cfg.Provider)
+	}
+	apiKey := ""
+	if cfg.APIKeyEnv != "" {
+		apiKey = os.Getenv(cfg.APIKeyEnv)
+	}
+	h := httpDoer{
+		client:  &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		retries: cfg.Retries,
+		backoff: time.Duration(cfg.Backoff) * time.Second,
+	}
+
+	switch cfg.Provider {
+	case "raw", "":
+		return &RawProvider{endpoint: cfg.Endpoint, http: h}, nil
+	case "openai":
+		return &OpenAIProvider{cfg: cfg, apiKey: apiKey, http: h}, nil
+	case "ollama":
+		return &OllamaProvider{cfg: cfg, http: h}, nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", cfg.Provider)
+	}
+}
+
+// httpDoer 发送 HTTP 请求，并在网络错误、429 和 5xx 时按指数退避重试
+type httpDoer struct {
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// statusError 表示接口返回了非 2xx 状态码
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.code, e.body)
+}
+
+func (e *statusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+func (h httpDoer) do(ctx context.Context, url string, header http.Header, body []byte) ([]byte, error) {
+	var lastErr error
+	wait := h.backoff
+	for attempt := 0; attempt <= h.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+
+		result, err := h.once(ctx, url, header, body)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		if se, ok := err.(*statusError); ok && !se.retryable() {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (h httpDoer) once(ctx context.Context, url string, header http.Header, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	result, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &statusError{code: resp.StatusCode, body: string(result)}
+	}
+	return result, nil
+}
+
+// postJSON 以 JSON 格式发送请求体并解析 JSON 回复
+func (h httpDoer) postJSON(ctx context.Context, url string, header http.Header, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %v", err)
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+
+	result, err := h.do(ctx, url, header, body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(result, out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
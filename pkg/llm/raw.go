@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RawProvider 将对话拼接为纯文本 POST 到自定义接口，并将响应体原样作为回复
+type RawProvider struct {
+	endpoint string
+	http     httpDoer
+}
+
+func (p *RawProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	result, err := p.http.do(ctx, p.endpoint, nil, []byte(render(messages)))
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// render 将对话拼接为单个字符串，供只接受原始文本的接口使用
+func render(messages []Message) string {
+	if len(messages) == 1 {
+		return messages[0].Content
+	}
+	var sb strings.Builder
+	for i, msg := range messages {
+		if i > 0 {
+			sb.WriteString("\n===\n")
+		}
+		fmt.Fprintf(&sb, "[%s]\n%s", msg.Role, msg.Content)
+	}
+	return sb.String()
+}
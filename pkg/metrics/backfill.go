@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/pkg/client"
+	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/model"
+	"time"
+)
+
+// Backfill 从来源读取各命名空间最近 lookback 内的历史数据写入指标库。
+// 每个命名空间记录已回填到的时间，重复回填时只读取之后的数据
+func Backfill(ctx context.Context, source HistorySource, namespaces []string, lookback time.Duration) error {
+	owners, err := client.NewOwnerResolver()
+	if err != nil {
+		fmt.Printf("Owner resolution disabled, relying on owners recorded by the metrics source: %v\n", err)
+	}
+	to := time.Now().Truncate(time.Second)
+	for _, ns := range namespaces {
+		until, err := db.BackfilledUntil(ns)
+		if err != nil {
+			return err
+		}
+		from, ok := backfillFrom(until, to, lookback)
+		if !ok {
+			fmt.Printf("Namespace %s is already backfilled\n", ns)
+			continue
+		}
+
+		snapshot, err := source.History(ctx, ns, from, to)
+		if err != nil {
+			return fmt.Errorf("read history of namespace %s: %w", ns, err)
+		}
+		resolve := func(namespace, pod string) model.Workload {
+			if owners != nil {
+				w, err := owners.Resolve(namespace, pod)
+				if err == nil {
+					return w
+				}
+			}
+			// Pod 已被删除时使用来源记录的工作负载
+			if w, ok := snapshot.Owners[pod]; ok {
+				return w
+			}
+			return model.Workload{Namespace: namespace, Kind: "Pod", Name: pod}
+		}
+		if err := storeBatch(snapshot, resolve); err != nil {
+			return fmt.Errorf("store history of namespace %s: %w", ns, err)
+		}
+		if err := db.SetBackfilledUntil(ns, to); err != nil {
+			return err
+		}
+		fmt.Printf("Backfilled %d usage and %d pressure samples for namespace %s from %s to %s\n",
+			len(snapshot.Usage), len(snapshot.Pressure), ns, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	DownsampleMetrics()
+	return nil
+}
+
+// backfillFrom 返回回填到 to 时的起始时间：最多回看 lookback，已回填到 until 时从其后开始。
+// 已回填到 to 时 ok 为 false
+func backfillFrom(until, to time.Time, lookback time.Duration) (from time.Time, ok bool) {
+	from = to.Add(-lookback)
+	if until.After(from) {
+		from = until.Add(time.Second)
+	}
+	return from, from.Before(to)
+}
+
+// storeBatch 将一次采集的数据批量写入指标库，resolve 返回 Pod 所属的工作负载
+func storeBatch(snapshot Snapshot, resolve func(namespace, pod string) model.Workload) error {
+	workloads := map[string]model.Workload{}
+	workload := func(namespace, pod string) model.Workload {
+		key := namespace + "/" + pod
+		if w, ok := workloads[key]; ok {
+			return w
+		}
+		workloads[key] = resolve(namespace, pod)
+		return workloads[key]
+	}
+
+	usage := make([]db.MetricSample, 0, len(snapshot.Usage))
+	for _, m := range snapshot.Usage {
+		usage = append(usage, db.MetricSample{
+			Pod:         m.Pod,
+			Workload:    workload(m.Namespace, m.Pod),
+			Container:   m.Container,
+			CPUMilli:    m.CPUMilli,
+			MemoryBytes: m.MemoryBytes,
+			Timestamp:   m.Timestamp,
+		})
+	}
+	if err := db.InsertMetricsBatch(usage); err != nil {
+		return err
+	}
+
+	pressure := make([]db.PressureSample, 0, len(snapshot.Pressure))
+	for _, p := range snapshot.Pressure {
+		pressure = append(pressure, db.PressureSample{
+			Pod:        p.Pod,
+			Workload:   workload(p.Namespace, p.Pod),
+			Container:  p.Container,
+			Throttling: p.Throttling,
+			Restarts:   p.Restarts,
+			Timestamp:  p.Timestamp,
+		})
+	}
+	return db.InsertPressure(pressure)
+}
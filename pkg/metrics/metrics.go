@@ -7,6 +7,7 @@ import (
 	"kubefix-cli/conf"
 	"kubefix-cli/pkg/client"
 	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/model"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,8 +18,9 @@ import (
 type PodMetrics struct {
 	Pod         string    `json:"pod_name"`
 	Namespace   string    `json:"namespace"`
-	CPUUsage    string    `json:"cpu_usage"`
-	MemoryUsage string    `json:"memory_usage"`
+	Container   string    `json:"container"`
+	CPUMilli    int64     `json:"cpu_millicores"`
+	MemoryBytes int64     `json:"memory_bytes"`
 	Timestamp   time.Time `json:"timestamp"`
 }
 
@@ -39,51 +41,92 @@ func getPodCPUAndMemoryUsage(namespace string) ([]PodMetrics, error) {
 	}
 	result := []PodMetrics{}
 	for _, podMetric := range podMetricsList.Items {
-		cpuTotal := int64(0)
-		memTotal := int64(0)
+		// 每个容器单独记录，包括正在运行的 init 容器
 		for _, c := range podMetric.Containers {
-			cpu := c.Usage.Cpu().MilliValue()               // mCPU
-			mem := c.Usage.Memory().Value() / (1024 * 1024) // MiB
-			cpuTotal += cpu
-			memTotal += mem
-		}
-
-		var podMatrics PodMetrics
+			var podMatrics PodMetrics
 
-		podMatrics.Pod = podMetric.Name
-		podMatrics.Namespace = podMetric.Namespace
-		podMatrics.CPUUsage = fmt.Sprintf("%dm", cpuTotal)
-		podMatrics.MemoryUsage = fmt.Sprintf("%dMiB", memTotal)
+			podMatrics.Pod = podMetric.Name
+			podMatrics.Namespace = podMetric.Namespace
+			podMatrics.Container = c.Name
+			podMatrics.CPUMilli = c.Usage.Cpu().MilliValue()
+			podMatrics.MemoryBytes = c.Usage.Memory().Value()
+			podMatrics.Timestamp = podMetric.Timestamp.Time
+			if podMatrics.Timestamp.IsZero() {
+				podMatrics.Timestamp = time.Now()
+			}
 
-		result = append(result, podMatrics)
+			result = append(result, podMatrics)
+		}
 	}
 	return result, nil
 }
 
-func ObservePodMetrics() {
+// ObservePodMetrics 每分钟采集一次所有命名空间的容器指标，直到 ctx 结束。
+// 正在写入的数据会在返回前写完；无法创建来源或列出命名空间时返回错误
+func ObservePodMetrics(ctx context.Context) error {
+	source, err := NewSource(conf.Metrics)
+	if err != nil {
+		return fmt.Errorf("create metrics source: %w", err)
+	}
+	owners, err := client.NewOwnerResolver()
+	if err != nil {
+		return fmt.Errorf("create owner resolver: %w", err)
+	}
+	resolve := func(namespace, pod string) model.Workload {
+		workload, err := owners.Resolve(namespace, pod)
+		if err != nil {
+			fmt.Printf("Error resolving owner of pod %s in namespace %s: %v\n", pod, namespace, err)
+		}
+		return workload
+	}
+	DownsampleMetrics()
+
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
-	fmt.Println("Starting metrics collection for all pods in namespaces...")
-	for range ticker.C {
+	fmt.Printf("Starting metrics collection from %s for all pods in namespaces...\n", conf.Metrics.Source)
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Metrics collection stopped.")
+			return nil
+		case <-ticker.C:
+		}
 		namespaces, err := client.Namespaces()
 		if err != nil {
-			fmt.Printf("Error fetching namespaces: %v", err)
-			return
+			return fmt.Errorf("fetch namespaces: %w", err)
 		}
 		for _, ns := range namespaces {
+			if ctx.Err() != nil {
+				break
+			}
 			fmt.Printf("Collecting metrics for namespace: %s\n", ns)
-			podMetrics, err := getPodCPUAndMemoryUsage(ns)
+			collectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			snapshot, err := source.Collect(collectCtx, ns)
+			cancel()
 			if err != nil {
 				fmt.Printf("Error collecting metrics for namespace %s: %v", ns, err)
 				continue
 			}
-			for _, metrics := range podMetrics {
-				err := db.InsertMetrics(metrics.Pod, metrics.Namespace, metrics.CPUUsage, metrics.MemoryUsage)
-				if err != nil {
-					fmt.Printf("Error inserting metrics for pod %s in namespace %s: %v", metrics.Pod, ns, err)
-					continue
-				}
+			if err := storeBatch(snapshot, resolve); err != nil {
+				fmt.Printf("Error inserting metrics for namespace %s: %v", ns, err)
 			}
 		}
 	}
 }
+
+// DownsampleMetrics 将超过保留期的原始样本聚合为降采样桶，使长期观测数据保持可查询
+func DownsampleMetrics() {
+	if conf.Metrics.RawRetention <= 0 {
+		return
+	}
+	bucket := time.Duration(conf.Metrics.RollupInterval) * time.Minute
+	before := time.Now().Add(-time.Duration(conf.Metrics.RawRetention) * time.Hour).Truncate(bucket)
+	n, err := db.DownsampleMetrics(before, bucket)
+	if err != nil {
+		fmt.Printf("Error downsampling metrics: %v\n", err)
+		return
+	}
+	if n > 0 {
+		fmt.Printf("Downsampled %d metric samples older than %s\n", n, before.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,290 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/model"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPoints 是单次范围查询每个序列的最大点数，Prometheus 的上限为 11000
+const maxPoints = 10000
+
+// PrometheusSource 通过 Prometheus HTTP API 读取容器的资源使用、CPU 限流和重启次数
+type PrometheusSource struct {
+	cfg    conf.PrometheusConfig
+	client *http.Client
+	token  string
+}
+
+func NewPrometheusSource(cfg conf.PrometheusConfig) (*PrometheusSource, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("prometheus url is not configured")
+	}
+	token := ""
+	if cfg.BearerTokenEnv != "" {
+		token = os.Getenv(cfg.BearerTokenEnv)
+	}
+	return &PrometheusSource{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		token:  token,
+	}, nil
+}
+
+// Collect 以即时查询读取当前的资源使用
+func (p *PrometheusSource) Collect(ctx context.Context, namespace string) (Snapshot, error) {
+	now := time.Now()
+	params := url.Values{"time": {formatTime(now)}}
+	return p.snapshot(ctx, "/api/v1/query", params, namespace, 5*time.Minute)
+}
+
+// History 以范围查询读取 [from, to] 内按配置间隔采样的数据，时间跨度较大时分段查询
+func (p *PrometheusSource) History(ctx context.Context, namespace string, from, to time.Time) (Snapshot, error) {
+	step := time.Duration(p.cfg.Step) * time.Second
+	chunk := step * maxPoints
+	var result Snapshot
+	for start := from; !start.After(to); start = start.Add(chunk + step) {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+		params := url.Values{"start": {formatTime(start)}, "end": {formatTime(end)}, "step": {strconv.Itoa(p.cfg.Step)}}
+		part, err := p.snapshot(ctx, "/api/v1/query_range", params, namespace, 0)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		result.Usage = append(result.Usage, part.Usage...)
+		result.Pressure = append(result.Pressure, part.Pressure...)
+	}
+	result.Owners = p.owners(ctx, namespace, to, to.Sub(from))
+	return result, nil
+}
+
+// snapshot 执行使用量、限流和重启的查询，并按 Pod、容器和时间合并结果。
+// 使用量查询失败时返回错误；限流和重启依赖 cAdvisor 与 kube-state-metrics，查询失败时只打印警告
+func (p *PrometheusSource) snapshot(ctx context.Context, path string, params url.Values, namespace string, window time.Duration) (Snapshot, error) {
+	q := p.cfg.Queries
+	cpu, err := p.query(ctx, path, params, q.CPU, namespace, window)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("cpu query: %w", err)
+	}
+	memory, err := p.query(ctx, path, params, q.Memory, namespace, window)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("memory query: %w", err)
+	}
+	throttling, err := p.query(ctx, path, params, q.Throttling, namespace, window)
+	if err != nil {
+		fmt.Printf("Warning: throttling query failed for namespace %s: %v\n", namespace, err)
+	}
+	restarts, err := p.query(ctx, path, params, q.Restarts, namespace, window)
+	if err != nil {
+		fmt.Printf("Warning: restarts query failed for namespace %s: %v\n", namespace, err)
+	}
+
+	type key struct {
+		pod, container string
+		ts             int64
+	}
+	cpuByKey := map[key]float64{}
+	for _, s := range cpu {
+		for _, pt := range s.points() {
+			cpuByKey[key{s.Metric["pod"], s.Metric["container"], pt.Time.Unix()}] = pt.Value
+		}
+	}
+	var result Snapshot
+	for _, s := range memory {
+		for _, pt := range s.points() {
+			k := key{s.Metric["pod"], s.Metric["container"], pt.Time.Unix()}
+			c, ok := cpuByKey[k]
+			if !ok || k.pod == "" || k.container == "" {
+				continue
+			}
+			result.Usage = append(result.Usage, PodMetrics{
+				Pod:         k.pod,
+				Namespace:   namespace,
+				Container:   k.container,
+				CPUMilli:    int64(math.Ceil(c)),
+				MemoryBytes: int64(pt.Value),
+				Timestamp:   pt.Time,
+			})
+		}
+	}
+
+	pressure := map[key]*ContainerPressure{}
+	var order []key
+	get := func(s promSeries, pt promPoint) *ContainerPressure {
+		k := key{s.Metric["pod"], s.Metric["container"], pt.Time.Unix()}
+		if pressure[k] == nil {
+			pressure[k] = &ContainerPressure{Pod: k.pod, Namespace: namespace, Container: k.container, Timestamp: pt.Time}
+			order = append(order, k)
+		}
+		return pressure[k]
+	}
+	for _, s := range throttling {
+		for _, pt := range s.points() {
+			get(s, pt).Throttling = pt.Value
+		}
+	}
+	for _, s := range restarts {
+		for _, pt := range s.points() {
+			get(s, pt).Restarts = int64(pt.Value)
+		}
+	}
+	for _, k := range order {
+		if k.pod != "" && k.container != "" {
+			result.Pressure = append(result.Pressure, *pressure[k])
+		}
+	}
+	return result, nil
+}
+
+// owners 根据 kube-state-metrics 记录的 ownerReferences 解析回看窗口内出现过的 Pod 所属的顶层工作负载
+func (p *PrometheusSource) owners(ctx context.Context, namespace string, at time.Time, window time.Duration) map[string]model.Workload {
+	q := p.cfg.Queries
+	params := url.Values{"time": {formatTime(at)}}
+	ownerOf := func(query, label string) map[string]model.Workload {
+		series, err := p.query(ctx, "/api/v1/query", params, query, namespace, window)
+		if err != nil {
+			fmt.Printf("Warning: owner query failed for namespace %s: %v\n", namespace, err)
+		}
+		owners := map[string]model.Workload{}
+		for _, s := range series {
+			if s.Metric[label] != "" && s.Metric["owner_kind"] != "" && s.Metric["owner_kind"] != "<none>" {
+				owners[s.Metric[label]] = model.Workload{Namespace: namespace, Kind: s.Metric["owner_kind"], Name: s.Metric["owner_name"]}
+			}
+		}
+		return owners
+	}
+	pods := ownerOf(q.PodOwner, "pod")
+	if len(pods) == 0 {
+		return pods
+	}
+	parents := map[string]map[string]model.Workload{
+		"ReplicaSet": ownerOf(q.ReplicaSetOwner, "replicaset"),
+		"Job":        ownerOf(q.JobOwner, "job_name"),
+	}
+	for pod, w := range pods {
+		if parent, ok := parents[w.Kind][w.Name]; ok {
+			pods[pod] = parent
+		}
+	}
+	return pods
+}
+
+type promResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string       `json:"resultType"`
+		Result     []promSeries `json:"result"`
+	} `json:"data"`
+}
+
+// promSeries 是即时查询（value）或范围查询（values）返回的一个序列
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  *promPoint        `json:"value,omitempty"`
+	Values []promPoint       `json:"values,omitempty"`
+}
+
+// points 返回序列中的有效数据点，NaN 和无穷大会被跳过
+func (s promSeries) points() []promPoint {
+	points := s.Values
+	if s.Value != nil {
+		points = append(points, *s.Value)
+	}
+	valid := points[:0:0]
+	for _, pt := range points {
+		if !math.IsNaN(pt.Value) && !math.IsInf(pt.Value, 0) {
+			valid = append(valid, pt)
+		}
+	}
+	return valid
+}
+
+// promPoint 是 Prometheus 以 [<unix 时间>, "<值>"] 表示的数据点
+type promPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+func (p *promPoint) UnmarshalJSON(data []byte) error {
+	var raw []any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 2 {
+		return fmt.Errorf("invalid sample %s", data)
+	}
+	ts, ok := raw[0].(float64)
+	value, ok2 := raw[1].(string)
+	if !ok || !ok2 {
+		return fmt.Errorf("invalid sample %s", data)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sample value %q: %w", value, err)
+	}
+	sec, frac := math.Modf(ts)
+	p.Time = time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond))
+	p.Value = v
+	return nil
+}
+
+func (p promPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{float64(p.Time.UnixMilli()) / 1000, strconv.FormatFloat(p.Value, 'f', -1, 64)})
+}
+
+// query 将 PromQL 中的 $namespace 和 $window 替换后发送给 Prometheus
+func (p *PrometheusSource) query(ctx context.Context, path string, params url.Values, query, namespace string, window time.Duration) ([]promSeries, error) {
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	query = strings.NewReplacer("$namespace", namespace, "$window", fmt.Sprintf("%ds", int64(window.Seconds()))).Replace(query)
+	form := url.Values{"query": {query}}
+	for k, v := range params {
+		form[k] = v
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(p.cfg.URL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+
+	var result promResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unexpected response (status %d): %s", resp.StatusCode, body)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("%s: %s", result.ErrorType, result.Error)
+	}
+	return result.Data.Result, nil
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64)
+}
@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"kubefix-cli/conf"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePrometheus 实现了 Prometheus 的即时查询和范围查询接口，按完整的 PromQL 返回预设的序列。
+// 未预设的查询返回空结果
+type fakePrometheus struct {
+	series map[string][]fakeSeries
+
+	mu      sync.Mutex
+	queries []string
+}
+
+// fakeSeries 是一个预设序列，Value 返回序列在给定时刻的值，返回 false 表示该时刻没有数据
+type fakeSeries struct {
+	Labels map[string]string
+	Value  func(t time.Time) (float64, bool)
+}
+
+func (f *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		f.fail(w, "bad_data", err.Error())
+		return
+	}
+	query := r.Form.Get("query")
+	f.mu.Lock()
+	f.queries = append(f.queries, query)
+	f.mu.Unlock()
+
+	var times []time.Time
+	resultType := "vector"
+	switch r.URL.Path {
+	case "/api/v1/query":
+		at := time.Now()
+		if v := r.Form.Get("time"); v != "" {
+			t, err := parseFakeTime(v)
+			if err != nil {
+				f.fail(w, "bad_data", err.Error())
+				return
+			}
+			at = t
+		}
+		times = []time.Time{at}
+	case "/api/v1/query_range":
+		start, err1 := parseFakeTime(r.Form.Get("start"))
+		end, err2 := parseFakeTime(r.Form.Get("end"))
+		step, err3 := strconv.ParseFloat(r.Form.Get("step"), 64)
+		if err1 != nil || err2 != nil || err3 != nil || step <= 0 {
+			f.fail(w, "bad_data", "invalid start, end or step")
+			return
+		}
+		for t := start; !t.After(end); t = t.Add(time.Duration(step * float64(time.Second))) {
+			times = append(times, t)
+		}
+		resultType = "matrix"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var resp promResponse
+	resp.Status = "success"
+	resp.Data.ResultType = resultType
+	resp.Data.Result = []promSeries{}
+	for _, s := range f.series[query] {
+		series := promSeries{Metric: s.Labels}
+		for _, t := range times {
+			if v, ok := s.Value(t); ok {
+				series.Values = append(series.Values, promPoint{Time: t, Value: v})
+			}
+		}
+		if len(series.Values) == 0 {
+			continue
+		}
+		if resultType == "vector" {
+			series.Value, series.Values = &series.Values[0], nil
+		}
+		resp.Data.Result = append(resp.Data.Result, series)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakePrometheus) fail(w http.ResponseWriter, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(promResponse{Status: "error", ErrorType: errorType, Error: message})
+}
+
+func parseFakeTime(v string) (time.Time, error) {
+	ts, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)), nil
+}
+
+// count 返回 query 被查询的次数
+func (f *fakePrometheus) count(query string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, q := range f.queries {
+		if q == query {
+			n++
+		}
+	}
+	return n
+}
+
+// newFakeSource 返回查询 fake 的 PrometheusSource，查询中的 $namespace 会被替换为 default
+func newFakeSource(t *testing.T, fake *fakePrometheus, step int) *PrometheusSource {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	source, err := NewPrometheusSource(conf.PrometheusConfig{URL: srv.URL, Timeout: 5, Step: step, Queries: conf.PrometheusQuery{
+		CPU:        `cpu{namespace="$namespace"}`,
+		Memory:     `memory{namespace="$namespace"}`,
+		Throttling: `throttling{namespace="$namespace"}`,
+		Restarts:   `restarts{namespace="$namespace"}`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func always(v float64) func(time.Time) (float64, bool) {
+	return func(time.Time) (float64, bool) { return v, true }
+}
+
+func TestHistoryChunksRangeQueries(t *testing.T) {
+	from := time.Unix(1700000000, 0)
+	points := 2*maxPoints + 500
+	to := from.Add(time.Duration(points-1) * time.Minute)
+	half := from.Add(time.Duration(points/2) * time.Minute)
+
+	labels := map[string]string{"namespace": "default", "pod": "web-1", "container": "app"}
+	fake := &fakePrometheus{series: map[string][]fakeSeries{
+		`cpu{namespace="default"}`:    {{Labels: labels, Value: always(120.2)}},
+		`memory{namespace="default"}`: {{Labels: labels, Value: always(64 << 20)}},
+		// 限流数据只在前一半时间内存在
+		`throttling{namespace="default"}`: {{Labels: labels, Value: func(t time.Time) (float64, bool) { return 0.5, t.Before(half) }}},
+	}}
+	source := newFakeSource(t, fake, 60)
+	snapshot, err := source.History(context.Background(), "default", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fake.count(`cpu{namespace="default"}`); got != 3 {
+		t.Errorf("cpu queried %d times, want 3 chunks", got)
+	}
+	if len(snapshot.Usage) != points {
+		t.Fatalf("got %d usage samples, want %d", len(snapshot.Usage), points)
+	}
+	// 分段之间既不重叠也不遗漏
+	for i, u := range snapshot.Usage {
+		if want := from.Add(time.Duration(i) * time.Minute); !u.Timestamp.Equal(want) {
+			t.Fatalf("sample %d at %v, want %v", i, u.Timestamp, want)
+		}
+		if u.Pod != "web-1" || u.Container != "app" || u.CPUMilli != 121 || u.MemoryBytes != 64<<20 {
+			t.Fatalf("sample %d = %+v", i, u)
+		}
+	}
+	if len(snapshot.Pressure) != points/2 {
+		t.Errorf("got %d pressure samples, want %d", len(snapshot.Pressure), points/2)
+	}
+}
+
+func TestCollectSkipsInvalidSeries(t *testing.T) {
+	fake := &fakePrometheus{series: map[string][]fakeSeries{
+		`cpu{namespace="default"}`: {
+			{Labels: map[string]string{"pod": "web-1", "container": "app"}, Value: always(10)},
+			{Labels: map[string]string{"pod": "web-2", "container": "app"}, Value: always(math.NaN())},
+			{Labels: map[string]string{"pod": "web-3"}, Value: always(10)},
+		},
+		`memory{namespace="default"}`: {
+			{Labels: map[string]string{"pod": "web-1", "container": "app"}, Value: always(1 << 20)},
+			{Labels: map[string]string{"pod": "web-2", "container": "app"}, Value: always(1 << 20)},
+			{Labels: map[string]string{"pod": "web-3"}, Value: always(1 << 20)},
+		},
+		`restarts{namespace="default"}`: {{Labels: map[string]string{"pod": "web-1", "container": "app"}, Value: always(3)}},
+	}}
+	source := newFakeSource(t, fake, 60)
+
+	snapshot, err := source.Collect(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Usage) != 1 || snapshot.Usage[0].Pod != "web-1" || snapshot.Usage[0].CPUMilli != 10 {
+		t.Errorf("usage = %+v, want only web-1", snapshot.Usage)
+	}
+	if len(snapshot.Pressure) != 1 || snapshot.Pressure[0].Restarts != 3 {
+		t.Errorf("pressure = %+v", snapshot.Pressure)
+	}
+}
+
+func TestCollectFailsWithoutUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(&fakePrometheus{}).fail(w, "bad_data", "parse error")
+	}))
+	defer srv.Close()
+	source, err := NewPrometheusSource(conf.PrometheusConfig{URL: srv.URL, Timeout: 5, Step: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Collect(context.Background(), "default"); err == nil {
+		t.Error("Collect() succeeded although the usage query failed")
+	}
+}
+
+func TestBackfillFrom(t *testing.T) {
+	to := time.Unix(1700000000, 0)
+	lookback := 24 * time.Hour
+	tests := []struct {
+		name  string
+		until time.Time
+		from  time.Time
+		ok    bool
+	}{
+		{"never backfilled", time.Time{}, to.Add(-lookback), true},
+		{"backfilled before the lookback", to.Add(-48 * time.Hour), to.Add(-lookback), true},
+		{"continues after the last backfill", to.Add(-time.Hour), to.Add(-time.Hour + time.Second), true},
+		{"already backfilled", to, to.Add(time.Second), false},
+		{"backfilled less than a second ago", to.Add(-time.Second), to, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, ok := backfillFrom(tt.until, to, lookback)
+			if ok != tt.ok || (ok && !from.Equal(tt.from)) {
+				t.Errorf("backfillFrom() = %v, %v, want %v, %v", from, ok, tt.from, tt.ok)
+			}
+		})
+	}
+}
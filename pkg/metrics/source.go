@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"kubefix-cli/conf"
+	"kubefix-cli/pkg/model"
+	"time"
+)
+
+// Source 是容器资源使用数据的来源
+type Source interface {
+	// Collect 采集命名空间内各容器当前的资源使用
+	Collect(ctx context.Context, namespace string) (Snapshot, error)
+}
+
+// HistorySource 是能够提供历史数据的来源，可用于在没有实时观测的情况下回填指标库
+type HistorySource interface {
+	Source
+	// History 读取命名空间内各容器在 [from, to] 内的资源使用
+	History(ctx context.Context, namespace string, from, to time.Time) (Snapshot, error)
+}
+
+// Snapshot 是一次采集得到的数据
+type Snapshot struct {
+	Usage    []PodMetrics
+	Pressure []ContainerPressure
+	// Owners 是来源记录的 Pod 所属工作负载，用于解析已被删除的 Pod，来源不提供时为空
+	Owners map[string]model.Workload
+}
+
+// ContainerPressure 是容器的 CPU 限流与重启情况
+type ContainerPressure struct {
+	Pod        string
+	Namespace  string
+	Container  string
+	Throttling float64 // 被限流的 CFS 周期占比，0 到 1
+	Restarts   int64   // 容器累计重启次数
+	Timestamp  time.Time
+}
+
+// NewSource 根据配置创建指标来源
+func NewSource(cfg conf.MetricsConfig) (Source, error) {
+	switch cfg.Source {
+	case "metrics-server", "":
+		return MetricsServerSource{}, nil
+	case "prometheus":
+		return NewPrometheusSource(cfg.Prometheus)
+	default:
+		return nil, fmt.Errorf("unknown metrics source %q", cfg.Source)
+	}
+}
+
+// MetricsServerSource 从 metrics-server 读取容器当前的资源使用，不提供限流、重启和历史数据
+type MetricsServerSource struct{}
+
+func (MetricsServerSource) Collect(ctx context.Context, namespace string) (Snapshot, error) {
+	usage, err := getPodCPUAndMemoryUsage(namespace)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Usage: usage}, nil
+}
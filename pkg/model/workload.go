@@ -0,0 +1,13 @@
+package model
+
+// Workload 标识一个拥有 Pod 的顶层工作负载，例如 Deployment、StatefulSet、DaemonSet 或 CronJob，
+// 没有 owner 的 Pod 自身即为工作负载
+type Workload struct {
+	Namespace string
+	Kind      string
+	Name      string
+}
+
+func (w Workload) String() string {
+	return w.Namespace + "/" + w.Kind + "/" + w.Name
+}
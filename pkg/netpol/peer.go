@@ -0,0 +1,68 @@
+// Package netpol generates least-privilege NetworkPolicies from observed connections
+package netpol
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+)
+
+// volatileLabels 是控制器为每一代 Pod 生成的标签，不能用于选择对端
+var volatileLabels = []string{
+	"pod-template-hash",
+	"controller-revision-hash",
+	"pod-template-generation",
+	"statefulset.kubernetes.io/pod-name",
+	"apps.kubernetes.io/pod-index",
+	"controller-uid",
+	"batch.kubernetes.io/controller-uid",
+	"job-name",
+	"batch.kubernetes.io/job-name",
+}
+
+// Peer 是连接对端
+type Peer struct {
+	Namespace string            // 对端所在命名空间，外部地址为空
+	Labels    map[string]string // 对端 Pod 的标签选择器
+	Service   string            // 经由 Service 访问时的 Service 名称
+	IPs       []string          // 无法用选择器表示时按 IP 匹配的地址
+}
+
+// peerOf 返回连接在观测时解析出的对端和端口。经由 Service 访问时端口为转发后的目标端口；
+// 没有 selector 的 Service（例如 kubernetes）按其 Endpoints 的地址匹配；无法解析的对端按原始 IP 匹配
+func peerOf(c db.Connection) (Peer, PortSpec) {
+	portSpec := PortSpec{Protocol: c.Protocol, Port: fmt.Sprint(c.Port)}
+	if c.Peer.Port != "" {
+		portSpec.Port = c.Peer.Port
+	}
+	switch {
+	case !c.Peer.Resolved():
+		return Peer{IPs: []string{c.PeerIP}}, portSpec
+	case len(c.Peer.Addresses) > 0:
+		return Peer{Service: c.Peer.Service, IPs: c.Peer.Addresses}, portSpec
+	case c.Peer.Service != "":
+		return Peer{Namespace: c.Peer.Namespace, Labels: c.Peer.Labels, Service: c.Peer.Service}, portSpec
+	default:
+		return Peer{Namespace: c.Peer.Namespace, Labels: stableLabels(c.Peer.Labels)}, portSpec
+	}
+}
+
+func stableLabels(labels map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range labels {
+		result[k] = v
+	}
+	for _, k := range volatileLabels {
+		delete(result, k)
+	}
+	return result
+}
+
+// ControllerManaged 根据控制器注入的标签判断 Pod 是否由控制器创建
+func ControllerManaged(labels map[string]string) bool {
+	for _, k := range volatileLabels {
+		if _, ok := labels[k]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package netpol
+
+import (
+	"fmt"
+	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/fixer"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const namespaceLabel = "kubernetes.io/metadata.name"
+
+// PortSpec 是 NetworkPolicy 中的一个端口，Port 可以是端口号或命名端口
+type PortSpec struct {
+	Protocol string
+	Port     string
+}
+
+func (p PortSpec) object() map[string]any {
+	port := any(p.Port)
+	if n, err := strconv.Atoi(p.Port); err == nil {
+		port = n
+	}
+	return map[string]any{"protocol": p.Protocol, "port": port}
+}
+
+// rule 是与同一对端的所有连接
+type rule struct {
+	peers []any
+	ports []PortSpec
+}
+
+// Generate 根据工作负载观测到的连接生成最小权限的 NetworkPolicy。对端使用观测时解析出的身份，
+// 不依赖生成时集群中的 Pod IP
+func Generate(workload *fixer.Manifest, conns []db.Connection) (map[string]any, error) {
+	selector := stableLabels(workload.PodLabels())
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("%s/%s has no pod labels to select", workload.Kind(), workload.Name())
+	}
+
+	rules := map[string]map[string]*rule{db.DirectionIngress: {}, db.DirectionEgress: {}}
+	for _, c := range conns {
+		if ip := net.ParseIP(c.PeerIP); ip == nil || ip.IsLoopback() {
+			continue
+		}
+		peer, port := peerOf(c)
+		if c.Direction == db.DirectionIngress {
+			// 入站连接的端口是本地端口，不需要经过 Service 转换
+			port = PortSpec{Protocol: c.Protocol, Port: strconv.Itoa(c.Port)}
+		}
+		objs := peerObjects(peer)
+		key := fmt.Sprint(objs)
+		r, ok := rules[c.Direction][key]
+		if !ok {
+			r = &rule{peers: objs}
+			rules[c.Direction][key] = r
+		}
+		if !slices.Contains(r.ports, port) {
+			r.ports = append(r.ports, port)
+		}
+	}
+
+	ingress := ruleObjects(rules[db.DirectionIngress], "from")
+	egress := append(ruleObjects(rules[db.DirectionEgress], "to"), dnsRule())
+
+	return map[string]any{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]any{
+			"name":      PolicyName(workload),
+			"namespace": workload.Namespace(),
+		},
+		"spec": map[string]any{
+			"podSelector": map[string]any{"matchLabels": toAny(selector)},
+			"policyTypes": []any{"Ingress", "Egress"},
+			"ingress":     ingress,
+			"egress":      egress,
+		},
+	}, nil
+}
+
+// DefaultDeny 生成命名空间的默认拒绝策略
+func DefaultDeny(namespace string) map[string]any {
+	return map[string]any{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]any{
+			"name":      "kubefix-default-deny",
+			"namespace": namespace,
+		},
+		"spec": map[string]any{
+			"podSelector": map[string]any{},
+			"policyTypes": []any{"Ingress", "Egress"},
+		},
+	}
+}
+
+// PolicyName 返回为工作负载生成的 NetworkPolicy 名称
+func PolicyName(workload *fixer.Manifest) string {
+	return "kubefix-" + strings.ToLower(workload.Kind()) + "-" + workload.Name()
+}
+
+func peerObjects(peer Peer) []any {
+	if len(peer.IPs) > 0 {
+		var objs []any
+		for _, ip := range slices.Sorted(slices.Values(peer.IPs)) {
+			bits := 32
+			if net.ParseIP(ip).To4() == nil {
+				bits = 128
+			}
+			objs = append(objs, map[string]any{"ipBlock": map[string]any{"cidr": fmt.Sprintf("%s/%d", ip, bits)}})
+		}
+		return objs
+	}
+	obj := map[string]any{
+		"namespaceSelector": map[string]any{"matchLabels": map[string]any{namespaceLabel: peer.Namespace}},
+	}
+	if len(peer.Labels) > 0 {
+		obj["podSelector"] = map[string]any{"matchLabels": toAny(peer.Labels)}
+	}
+	return []any{obj}
+}
+
+func ruleObjects(rules map[string]*rule, peerField string) []any {
+	result := []any{}
+	for _, key := range slices.Sorted(maps.Keys(rules)) {
+		r := rules[key]
+		slices.SortFunc(r.ports, func(a, b PortSpec) int {
+			return strings.Compare(a.Protocol+"/"+a.Port, b.Protocol+"/"+b.Port)
+		})
+		ports := make([]any, 0, len(r.ports))
+		for _, p := range r.ports {
+			ports = append(ports, p.object())
+		}
+		result = append(result, map[string]any{peerField: r.peers, "ports": ports})
+	}
+	return result
+}
+
+// dnsRule 允许访问集群 DNS。DNS 查询过于频繁，通常不会被完整观测到，但缺少它几乎所有工作负载都会失效
+func dnsRule() map[string]any {
+	return map[string]any{
+		"to": []any{map[string]any{
+			"namespaceSelector": map[string]any{"matchLabels": map[string]any{namespaceLabel: "kube-system"}},
+			"podSelector":       map[string]any{"matchLabels": map[string]any{"k8s-app": "kube-dns"}},
+		}},
+		"ports": []any{
+			PortSpec{Protocol: "UDP", Port: "53"}.object(),
+			PortSpec{Protocol: "TCP", Port: "53"}.object(),
+		},
+	}
+}
+
+func toAny(m map[string]string) map[string]any {
+	result := map[string]any{}
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
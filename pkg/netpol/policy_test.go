@@ -0,0 +1,155 @@
+package netpol
+
+import (
+	"kubefix-cli/pkg/db"
+	"kubefix-cli/pkg/fixer"
+	"reflect"
+	"testing"
+)
+
+func TestPeerOf(t *testing.T) {
+	tests := []struct {
+		name string
+		conn db.Connection
+		peer Peer
+		port PortSpec
+	}{
+		{
+			name: "unresolved address",
+			conn: db.Connection{PeerIP: "203.0.113.7", Port: 443, Protocol: "TCP"},
+			peer: Peer{IPs: []string{"203.0.113.7"}},
+			port: PortSpec{Protocol: "TCP", Port: "443"},
+		},
+		{
+			name: "pod drops volatile labels",
+			conn: db.Connection{PeerIP: "10.0.0.5", Port: 5432, Protocol: "TCP", Peer: db.ConnectionPeer{
+				Namespace: "db", Labels: map[string]string{"app": "postgres", "pod-template-hash": "abc", "statefulset.kubernetes.io/pod-name": "postgres-0"},
+			}},
+			peer: Peer{Namespace: "db", Labels: map[string]string{"app": "postgres"}},
+			port: PortSpec{Protocol: "TCP", Port: "5432"},
+		},
+		{
+			name: "service uses its selector and target port",
+			conn: db.Connection{PeerIP: "10.96.0.20", Port: 80, Protocol: "TCP", Peer: db.ConnectionPeer{
+				Namespace: "shop", Labels: map[string]string{"app": "api"}, Service: "api", Port: "http",
+			}},
+			peer: Peer{Namespace: "shop", Labels: map[string]string{"app": "api"}, Service: "api"},
+			port: PortSpec{Protocol: "TCP", Port: "http"},
+		},
+		{
+			name: "selector-less service uses its endpoints",
+			conn: db.Connection{PeerIP: "10.96.0.1", Port: 443, Protocol: "TCP", Peer: db.ConnectionPeer{
+				Namespace: "default", Service: "kubernetes", Addresses: []string{"192.168.1.10", "192.168.1.11"}, Port: "6443",
+			}},
+			peer: Peer{Service: "kubernetes", IPs: []string{"192.168.1.10", "192.168.1.11"}},
+			port: PortSpec{Protocol: "TCP", Port: "6443"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer, port := peerOf(tt.conn)
+			if !reflect.DeepEqual(peer, tt.peer) || port != tt.port {
+				t.Errorf("peerOf() = %+v, %+v, want %+v, %+v", peer, port, tt.peer, tt.port)
+			}
+		})
+	}
+}
+
+const workloadManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+        pod-template-hash: abc
+    spec:
+      containers:
+      - name: web
+        image: web
+`
+
+func TestGenerate(t *testing.T) {
+	workload, err := fixer.ParseManifest([]byte(workloadManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := db.ConnectionPeer{Namespace: "shop", Labels: map[string]string{"app": "api"}, Service: "api", Port: "8080"}
+	conns := []db.Connection{
+		// 入站连接使用本地端口
+		{Direction: db.DirectionIngress, PeerIP: "10.0.0.9", Port: 8080, Protocol: "TCP",
+			Peer: db.ConnectionPeer{Namespace: "ingress", Labels: map[string]string{"app": "nginx"}}},
+		{Direction: db.DirectionEgress, PeerIP: "10.96.0.20", Port: 80, Protocol: "TCP", Peer: api},
+		{Direction: db.DirectionEgress, PeerIP: "10.96.0.20", Port: 9090, Protocol: "TCP", Peer: db.ConnectionPeer{
+			Namespace: "shop", Labels: map[string]string{"app": "api"}, Service: "api", Port: "metrics"}},
+		{Direction: db.DirectionEgress, PeerIP: "10.96.0.20", Port: 80, Protocol: "TCP", Peer: api},
+		{Direction: db.DirectionEgress, PeerIP: "10.96.0.1", Port: 443, Protocol: "TCP", Peer: db.ConnectionPeer{
+			Namespace: "default", Service: "kubernetes", Addresses: []string{"192.168.1.10"}, Port: "6443"}},
+		{Direction: db.DirectionEgress, PeerIP: "203.0.113.7", Port: 443, Protocol: "TCP"},
+		{Direction: db.DirectionEgress, PeerIP: "2001:db8::1", Port: 53, Protocol: "UDP"},
+		{Direction: db.DirectionEgress, PeerIP: "127.0.0.1", Port: 6379, Protocol: "TCP"},
+		{Direction: db.DirectionEgress, PeerIP: "not-an-ip", Port: 80, Protocol: "TCP"},
+	}
+
+	policy, err := Generate(workload, conns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := policy["spec"].(map[string]any)
+	if want := map[string]any{"matchLabels": map[string]any{"app": "web"}}; !reflect.DeepEqual(spec["podSelector"], want) {
+		t.Errorf("podSelector = %v, want %v", spec["podSelector"], want)
+	}
+
+	ipBlock := func(cidr string) map[string]any {
+		return map[string]any{"ipBlock": map[string]any{"cidr": cidr}}
+	}
+	port := func(protocol string, port any) map[string]any {
+		return map[string]any{"protocol": protocol, "port": port}
+	}
+	wantIngress := []any{map[string]any{
+		"from": []any{map[string]any{
+			"namespaceSelector": map[string]any{"matchLabels": map[string]any{namespaceLabel: "ingress"}},
+			"podSelector":       map[string]any{"matchLabels": map[string]any{"app": "nginx"}},
+		}},
+		"ports": []any{port("TCP", 8080)},
+	}}
+	if !reflect.DeepEqual(spec["ingress"], wantIngress) {
+		t.Errorf("ingress = %v, want %v", spec["ingress"], wantIngress)
+	}
+
+	wantEgress := []any{
+		map[string]any{"to": []any{ipBlock("192.168.1.10/32")}, "ports": []any{port("TCP", 6443)}},
+		map[string]any{"to": []any{ipBlock("2001:db8::1/128")}, "ports": []any{port("UDP", 53)}},
+		map[string]any{"to": []any{ipBlock("203.0.113.7/32")}, "ports": []any{port("TCP", 443)}},
+		map[string]any{
+			"to": []any{map[string]any{
+				"namespaceSelector": map[string]any{"matchLabels": map[string]any{namespaceLabel: "shop"}},
+				"podSelector":       map[string]any{"matchLabels": map[string]any{"app": "api"}},
+			}},
+			"ports": []any{port("TCP", 8080), port("TCP", "metrics")},
+		},
+		dnsRule(),
+	}
+	egress := spec["egress"].([]any)
+	if len(egress) != len(wantEgress) {
+		t.Fatalf("egress = %v, want %v", egress, wantEgress)
+	}
+	for i := range wantEgress {
+		if !reflect.DeepEqual(egress[i], wantEgress[i]) {
+			t.Errorf("egress[%d] = %v, want %v", i, egress[i], wantEgress[i])
+		}
+	}
+}
+
+func TestGenerateWithoutLabels(t *testing.T) {
+	workload, err := fixer.ParseManifest([]byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\nspec:\n  containers:\n  - name: web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(workload, nil); err == nil {
+		t.Error("Generate() succeeded for a workload without pod labels")
+	}
+}
@@ -0,0 +1,84 @@
+// Package seccomp generates seccomp profiles from observed syscalls
+package seccomp
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+const (
+	ActionAllow = "SCMP_ACT_ALLOW"
+	ActionErrno = "SCMP_ACT_ERRNO"
+	ActionLog   = "SCMP_ACT_LOG"
+
+	// CRDAPIVersion 是 security-profiles-operator 的 SeccompProfile 资源版本
+	CRDAPIVersion = "security-profiles-operator.x-k8s.io/v1beta1"
+)
+
+// runtimeSyscalls 是容器运行时启动进程所必需的系统调用，它们发生在进程进入容器之前或太过频繁，
+// Falco 规则无法观测到，但缺少任何一个都会导致容器无法启动
+var runtimeSyscalls = []string{
+	"access", "arch_prctl", "brk", "capget", "capset", "chdir", "clone", "clone3", "close",
+	"dup3", "epoll_pwait", "execve", "exit", "exit_group", "faccessat2", "fchdir", "fchown",
+	"fcntl", "fstat", "fstatfs", "futex", "getdents64", "getegid", "geteuid", "getgid",
+	"getpid", "getppid", "getrandom", "gettid", "getuid", "ioctl", "lstat", "madvise", "mmap",
+	"mprotect", "munmap", "nanosleep", "newfstatat", "openat", "pipe2", "prctl", "prlimit64",
+	"read", "readlink", "rseq", "rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "sched_yield",
+	"select", "set_robust_list", "set_tid_address", "setgid", "setgroups", "setuid",
+	"sigaltstack", "stat", "tgkill", "uname", "wait4", "write",
+}
+
+var architectures = []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_X86", "SCMP_ARCH_X32", "SCMP_ARCH_AARCH64"}
+
+// Syscalls 是 seccomp profile 中的一条规则
+type Syscalls struct {
+	Names  []string `json:"names"`
+	Action string   `json:"action"`
+}
+
+// Profile 是 localhost seccomp profile 的 JSON 结构，也是 SeccompProfile CRD 的 spec
+type Profile struct {
+	DefaultAction string     `json:"defaultAction"`
+	Architectures []string   `json:"architectures"`
+	Syscalls      []Syscalls `json:"syscalls"`
+}
+
+// NewProfile 生成只允许观测到的系统调用及运行时必需系统调用的 profile。complete 表示 observed 完整捕获了
+// 容器的所有系统调用，此时其余系统调用返回 EPERM；否则白名单并不完整，其余系统调用只记录到审计日志（complain 模式）
+func NewProfile(observed []string, complete bool) Profile {
+	names := slices.Concat(runtimeSyscalls, observed)
+	slices.Sort(names)
+	names = slices.Compact(names)
+	action := ActionLog
+	if complete {
+		action = ActionErrno
+	}
+	return Profile{
+		DefaultAction: action,
+		Architectures: architectures,
+		Syscalls:      []Syscalls{{Names: names, Action: ActionAllow}},
+	}
+}
+
+// JSON 返回 localhost profile 文件内容
+func (p Profile) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// CRD 返回 security-profiles-operator 的 SeccompProfile 对象
+func (p Profile) CRD(namespace, name string) map[string]any {
+	var spec map[string]any
+	data, _ := json.Marshal(p)
+	_ = json.Unmarshal(data, &spec)
+	return map[string]any{
+		"apiVersion": CRDAPIVersion,
+		"kind":       "SeccompProfile",
+		"metadata":   map[string]any{"name": name, "namespace": namespace},
+		"spec":       spec,
+	}
+}
+
+// CRDLocalhostProfile 返回 security-profiles-operator 安装该 profile 后在节点上的相对路径
+func CRDLocalhostProfile(namespace, name string) string {
+	return "operator/" + namespace + "/" + name + ".json"
+}
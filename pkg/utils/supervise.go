@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+)
+
+// Supervise 运行 fn，直到其正常返回或 ctx 结束。fn 返回错误或 panic 时按指数退避重启，
+// 运行超过最大退避时间后退避重新从最小值开始
+func Supervise(ctx context.Context, name string, fn func(context.Context) error) {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := runProtected(ctx, fn)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			return
+		}
+		if time.Since(started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+		fmt.Printf("%s failed, restarting in %s: %v\n", name, delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// runProtected 运行 fn 并将 panic 转换为错误
+func runProtected(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}